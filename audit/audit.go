@@ -0,0 +1,141 @@
+// Package audit records who changed what through the admin API: the
+// actor, their role and IP, the entity and the fields before and after.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionErase  = "erase" // personal data anonymized, no snapshots are kept
+
+	ActionImpersonate = "impersonate"  // a staff user started acting as a customer
+	ActionRevoke      = "revoke"       // an API key, invite or session was revoked
+	ActionForceLogout = "force_logout" // every session of an account was revoked
+	ActionUnlock      = "unlock"       // failed logins of an account or IP were cleared
+)
+
+// Entity types recorded in the audit log.
+const (
+	EntityCategory = "category"
+	EntityProduct  = "product"
+	EntityCustomer = "customer"
+	EntityOrder    = "order"
+	EntityUser     = "user"
+
+	EntityAPIKey         = "api_key"
+	EntityInvite         = "invite"
+	EntitySession        = "session"
+	EntityLoginThrottle  = "login_throttle" // entity_id is 0, the key is in after
+	EntitySecurityPolicy = "security_policy"
+)
+
+// ignoredInDiff are fields that change on every write and would only add
+// noise to an update entry.
+var ignoredInDiff = map[string]bool{"updated_at": true, "version": true}
+
+// Snapshot converts a model to its JSON fields. Nested objects and lists
+// (preloaded relations) are left out; they are audited on their own.
+func Snapshot(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	for k, value := range fields {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			delete(fields, k)
+		}
+	}
+	return fields
+}
+
+// Diff returns only the fields that differ between two snapshots.
+func Diff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for k, a := range after {
+		if ignoredInDiff[k] {
+			continue
+		}
+		if b, ok := before[k]; !ok || !reflect.DeepEqual(a, b) {
+			changedBefore[k] = before[k]
+			changedAfter[k] = a
+		}
+	}
+	for k, b := range before {
+		if _, ok := after[k]; !ok && !ignoredInDiff[k] {
+			changedBefore[k] = b
+			changedAfter[k] = nil
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// Record stores an audit entry for the principal of the current request.
+// before is nil for creates and after is nil for deletes; for updates only
+// the changed fields are kept. Failures are logged and never fail the
+// request, which has already been committed.
+func Record(c *gin.Context, action, entityType string, entityID uint, before, after map[string]interface{}) {
+	if action == ActionUpdate {
+		before, after = Diff(before, after)
+		if len(after) == 0 {
+			return
+		}
+	}
+
+	entry := models.AuditLog{
+		ActorType:  actorType(c),
+		ActorID:    actorID(c),
+		ActorName:  c.GetString("username"),
+		Role:       c.GetString("role"),
+		IP:         c.ClientIP(),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     before,
+		After:      after,
+	}
+	// Changes made while impersonating a customer belong to the staff user.
+	if id := c.GetUint("impersonator_id"); id != 0 {
+		entry.ActorType, entry.ActorID = "user", id
+		entry.ActorName, entry.Role = c.GetString("impersonator_username"), c.GetString("impersonator_role")
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("audit: %s %s %d by %s: %v", action, entityType, entityID, entry.ActorName, err)
+	}
+}
+
+func actorType(c *gin.Context) string {
+	switch {
+	case c.GetString("auth_method") == "api_key":
+		return "api_key"
+	case c.GetString("role") == models.RoleCustomer:
+		return "customer"
+	default:
+		return "user"
+	}
+}
+
+func actorID(c *gin.Context) uint {
+	if id, ok := c.Get("api_key_id"); ok {
+		if v, ok := id.(uint); ok {
+			return v
+		}
+	}
+	return c.GetUint("user_id")
+}
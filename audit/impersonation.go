@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"log"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RecordImpersonatedRequest stores the current request with the staff user
+// behind it when it was made with an impersonation token. Call it after the
+// handler has run so the status is known.
+func RecordImpersonatedRequest(c *gin.Context) {
+	actorID := c.GetUint("impersonator_id")
+	if actorID == 0 {
+		return
+	}
+	entry := models.ImpersonatedRequest{
+		TokenID:    c.GetString("token_id"),
+		ActorID:    actorID,
+		ActorName:  c.GetString("impersonator_username"),
+		ActorRole:  c.GetString("impersonator_role"),
+		CustomerID: c.GetUint("customer_id"),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path, // without the query string, which may hold tokens
+		Status:     c.Writer.Status(),
+		IP:         c.ClientIP(),
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("audit: impersonated %s %s by %s: %v", entry.Method, entry.Path, entry.ActorName, err)
+	}
+}
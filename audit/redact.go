@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"example.com/go-xampp-api/models"
+	"gorm.io/gorm"
+)
+
+// personalFields are the snapshot fields of customers and orders that hold
+// personal data.
+var personalFields = []string{"name", "email", "phone", "login_phone", "address", "shipping_address"}
+
+// RedactCustomer removes the personal data of an erased customer from the
+// audit log: the fields in snapshots of the customer and of their orders,
+// and the name and IP of entries the customer made. Entries stay, so the
+// log still shows who changed what and when. Call it in the erasure
+// transaction.
+func RedactCustomer(tx *gorm.DB, customerID uint) error {
+	orderIDs := tx.Model(&models.Order{}).Select("id").Where("customer_id = ?", customerID)
+
+	// The OR is grouped, so the id cursor of FindInBatches applies to both
+	// sides and every batch moves on.
+	var entries []models.AuditLog
+	err := tx.Where(tx.Where("entity_type = ? AND entity_id = ?", EntityCustomer, customerID).
+		Or("entity_type = ? AND entity_id IN (?)", EntityOrder, orderIDs)).
+		FindInBatches(&entries, 200, func(_ *gorm.DB, _ int) error {
+			for _, entry := range entries {
+				before, changedBefore := redactSnapshot(entry.Before)
+				after, changedAfter := redactSnapshot(entry.After)
+				if !changedBefore && !changedAfter {
+					continue
+				}
+				if err := tx.Model(&models.AuditLog{}).Where("id = ?", entry.ID).
+					Updates(models.AuditLog{Before: before, After: after}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.AuditLog{}).
+		Where("actor_type = ? AND actor_id = ?", "customer", customerID).
+		Updates(map[string]interface{}{"actor_name": models.ErasedValue, "ip": ""}).Error
+}
+
+// redactSnapshot replaces the non-empty personal fields of a snapshot and
+// reports whether any was replaced.
+func redactSnapshot(snapshot map[string]interface{}) (map[string]interface{}, bool) {
+	changed := false
+	for _, k := range personalFields {
+		if v, ok := snapshot[k]; ok && v != nil && v != "" && v != models.ErasedValue {
+			snapshot[k] = models.ErasedValue
+			changed = true
+		}
+	}
+	return snapshot, changed
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/go-xampp-api/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRedactCustomerManyEntries(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Customer{}, &models.Order{}, &models.AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+
+	erased := models.Customer{Name: "Erased", Password: "x"}
+	kept := models.Customer{Name: "Kept", Password: "x"}
+	for _, c := range []*models.Customer{&erased, &kept} {
+		if err := db.Create(c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	order := models.Order{CustomerID: erased.ID, ShippingAddress: "Vientiane"}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// More customer entries than one batch, so the batches must move on.
+	personal := func() map[string]interface{} {
+		return map[string]interface{}{"name": "Somchai", "email": "s@example.com", "shipping_address": "Vientiane"}
+	}
+	var entries []models.AuditLog
+	for i := 0; i < 450; i++ {
+		entries = append(entries, models.AuditLog{Action: ActionUpdate, EntityType: EntityCustomer, EntityID: erased.ID, Before: personal(), After: personal()})
+	}
+	for i := 0; i < 30; i++ {
+		entries = append(entries, models.AuditLog{Action: ActionUpdate, EntityType: EntityOrder, EntityID: order.ID, After: personal()})
+	}
+	entries = append(entries,
+		models.AuditLog{Action: ActionUpdate, EntityType: EntityCustomer, EntityID: kept.ID, After: personal()},
+		models.AuditLog{ActorType: "customer", ActorID: erased.ID, ActorName: "Somchai", IP: "10.0.0.1", Action: ActionCreate, EntityType: EntityOrder, EntityID: 999},
+	)
+	if err := db.CreateInBatches(&entries, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Transaction(func(tx *gorm.DB) error { return RedactCustomer(tx, erased.ID) })
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("RedactCustomer did not finish")
+	}
+
+	var rows []models.AuditLog
+	if err := db.Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	redacted := 0
+	for _, row := range rows {
+		switch {
+		case row.EntityType == EntityCustomer && row.EntityID == kept.ID:
+			if row.After["name"] != "Somchai" {
+				t.Errorf("entry %d of another customer was redacted: %v", row.ID, row.After)
+			}
+		case row.ActorID == erased.ID && row.ActorType == "customer":
+			if row.ActorName != models.ErasedValue || row.IP != "" {
+				t.Errorf("entry %d made by the customer keeps actor %q, ip %q", row.ID, row.ActorName, row.IP)
+			}
+		default:
+			for _, snapshot := range []map[string]interface{}{row.Before, row.After} {
+				for _, k := range []string{"name", "email", "shipping_address"} {
+					if v, ok := snapshot[k]; ok && v != models.ErasedValue {
+						t.Fatalf("entry %d keeps %s = %v", row.ID, k, v)
+					}
+				}
+			}
+			redacted++
+		}
+	}
+	if redacted != 480 {
+		t.Errorf("redacted %d entries, want 480", redacted)
+	}
+}
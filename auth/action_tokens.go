@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"example.com/go-xampp-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidActionToken is returned for unknown, expired or used tokens.
+var ErrInvalidActionToken = errors.New("invalid or expired token")
+
+// CreateActionToken issues a single-use token for purpose and returns the
+// plain token to send to the subject. Earlier unused tokens for the same
+// purpose and subject stop working.
+func CreateActionToken(db *gorm.DB, purpose, subjectType string, subjectID uint, ttl time.Duration) (string, error) {
+	plain, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := db.Model(&models.ActionToken{}).
+		Where("purpose = ? AND subject_type = ? AND subject_id = ? AND used_at IS NULL", purpose, subjectType, subjectID).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	token := models.ActionToken{
+		Purpose:     purpose,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		TokenHash:   hash,
+		ExpiresAt:   now.Add(ttl),
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// FindActionToken returns a valid token without using it up.
+func FindActionToken(db *gorm.DB, purpose, plain string) (models.ActionToken, error) {
+	var token models.ActionToken
+	err := db.Where("token_hash = ? AND purpose = ?", HashToken(plain), purpose).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.ActionToken{}, ErrInvalidActionToken
+		}
+		return models.ActionToken{}, err
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return models.ActionToken{}, ErrInvalidActionToken
+	}
+	return token, nil
+}
+
+// ConsumeActionToken marks a token as used and returns it. A token can be
+// consumed only once, even by concurrent requests.
+func ConsumeActionToken(db *gorm.DB, purpose, plain string) (models.ActionToken, error) {
+	token, err := FindActionToken(db, purpose, plain)
+	if err != nil {
+		return models.ActionToken{}, err
+	}
+
+	now := time.Now()
+	result := db.Model(&models.ActionToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return models.ActionToken{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ActionToken{}, ErrInvalidActionToken
+	}
+	token.UsedAt = &now
+	return token, nil
+}
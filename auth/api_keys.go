@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks API keys so they can be told apart from JWTs.
+const APIKeyPrefix = "rk_"
+
+// APIKeyScopes are the permissions an API key can be granted. A scope is
+// "<resource>:<read|write>", where resource is the first path segment of
+// the route.
+var APIKeyScopes = []string{
+	"categories:read", "categories:write",
+	"products:read", "products:write",
+	"customers:read", "customers:write",
+	"orders:read", "orders:write",
+}
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired keys.
+var ErrInvalidAPIKey = errors.New("invalid, revoked or expired API key")
+
+// lastUsedPrecision limits how often last_used_at is written.
+const lastUsedPrecision = time.Minute
+
+// CreateAPIKey stores a new key and returns it with the plain key, which
+// is shown to the admin only once.
+func CreateAPIKey(name string, scopes []string, expiresAt *time.Time, createdByID uint) (models.APIKey, string, error) {
+	normalized, err := normalizeScopes(scopes)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	prefix, err := utils.RandomHex(6)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	secret, hash, err := NewOpaqueToken()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	key := models.APIKey{
+		Name:        name,
+		Prefix:      prefix,
+		KeyHash:     hash,
+		Scopes:      strings.Join(normalized, ","),
+		ExpiresAt:   expiresAt,
+		CreatedByID: createdByID,
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		return models.APIKey{}, "", err
+	}
+	return key, APIKeyPrefix + prefix + "_" + secret, nil
+}
+
+// AuthenticateAPIKey checks a plain key and records its use.
+func AuthenticateAPIKey(plain string) (models.APIKey, error) {
+	rest, ok := strings.CutPrefix(plain, APIKeyPrefix)
+	if !ok {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := database.DB.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.APIKey{}, ErrInvalidAPIKey
+		}
+		return models.APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(key.KeyHash)) != 1 {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedPrecision {
+		if err := database.DB.Model(&key).Update("last_used_at", now).Error; err != nil {
+			return models.APIKey{}, err
+		}
+	}
+	return key, nil
+}
+
+// HasScope reports whether the key grants scope.
+func HasScope(key models.APIKey, scope string) bool {
+	for _, s := range strings.Split(key.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeAPIKey revokes a key. It reports false when no active key has id.
+func RevokeAPIKey(id uint) (bool, error) {
+	result := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	allowed := make(map[string]bool, len(APIKeyScopes))
+	for _, s := range APIKeyScopes {
+		allowed[s] = true
+	}
+
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !allowed[s] {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClaimActor marks an impersonation token. It holds the staff user who
+// acts as the customer named by the other claims.
+const ClaimActor = "act"
+
+// Actor is the staff user behind an impersonation token.
+type Actor struct {
+	UserID   uint
+	Username string
+	Role     string
+}
+
+// IssueImpersonationToken returns a customer access token for a staff
+// user. It lives for IMPERSONATION_TTL, has no session and no refresh
+// token, and carries the staff user in the act claim.
+func IssueImpersonationToken(actor models.User, customer models.Customer) (utils.AccessToken, error) {
+	return utils.GenerateTokenWithClaims(customer.ID, customer.LoginName(), models.RoleCustomer, config.Current.Auth.ImpersonationTTL,
+		jwt.MapClaims{ClaimActor: map[string]interface{}{
+			"user_id":  actor.ID,
+			"username": actor.Username,
+			"role":     actor.Role,
+		}})
+}
+
+// ActorFromClaims returns the staff user of an impersonation token. ok is
+// false for ordinary tokens.
+func ActorFromClaims(claims jwt.MapClaims) (Actor, bool) {
+	act, ok := claims[ClaimActor].(map[string]interface{})
+	if !ok {
+		return Actor{}, false
+	}
+	userID, _ := act["user_id"].(float64)
+	username, _ := act["username"].(string)
+	role, _ := act["role"].(string)
+	return Actor{UserID: uint(userID), Username: username, Role: role}, true
+}
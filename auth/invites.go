@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidInvite is returned for unknown, expired, revoked or used invites
+// and for invites addressed to a different email.
+var ErrInvalidInvite = errors.New("invalid or expired invite")
+
+// IsStaffRole reports whether role belongs to a staff user.
+func IsStaffRole(role string) bool {
+	return role == models.RoleAdmin || role == models.RoleStaff
+}
+
+// CreateInvite stores a new invite and returns it with the plain token.
+func CreateInvite(role, email string, ttl time.Duration, createdByID uint) (models.UserInvite, string, error) {
+	plain, hash, err := NewOpaqueToken()
+	if err != nil {
+		return models.UserInvite{}, "", err
+	}
+
+	invite := models.UserInvite{
+		Email:       strings.ToLower(strings.TrimSpace(email)),
+		Role:        role,
+		TokenHash:   hash,
+		ExpiresAt:   time.Now().Add(ttl),
+		CreatedByID: createdByID,
+	}
+	if err := database.DB.Create(&invite).Error; err != nil {
+		return models.UserInvite{}, "", err
+	}
+	return invite, plain, nil
+}
+
+// FindInvite returns the usable invite for plain. Invites addressed to an
+// email only work for that email.
+func FindInvite(db *gorm.DB, plain, email string) (models.UserInvite, error) {
+	var invite models.UserInvite
+	if err := db.Where("token_hash = ?", HashToken(plain)).First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.UserInvite{}, ErrInvalidInvite
+		}
+		return models.UserInvite{}, err
+	}
+	if invite.UsedAt != nil || invite.RevokedAt != nil || time.Now().After(invite.ExpiresAt) {
+		return models.UserInvite{}, ErrInvalidInvite
+	}
+	if invite.Email != "" && !strings.EqualFold(invite.Email, strings.TrimSpace(email)) {
+		return models.UserInvite{}, ErrInvalidInvite
+	}
+	return invite, nil
+}
+
+// ConsumeInvite marks the invite as used by userID. An invite can be used
+// only once, even by concurrent registrations.
+func ConsumeInvite(db *gorm.DB, inviteID, userID uint) error {
+	now := time.Now()
+	result := db.Model(&models.UserInvite{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", inviteID, now).
+		Updates(map[string]interface{}{"used_at": now, "used_by_id": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidInvite
+	}
+	return nil
+}
+
+// RevokeInvite stops an unused invite from working. It reports false when
+// there is no such unused invite.
+func RevokeInvite(id uint) (bool, error) {
+	result := database.DB.Model(&models.UserInvite{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountThrottleKey is the throttle key of a login identifier. It does not
+// depend on whether the account exists.
+func AccountThrottleKey(subjectType, identifier string) string {
+	return subjectType + ":" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// IPThrottleKey is the throttle key of a client IP address.
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginRetryAfter returns how long logins for any of keys are locked, or 0
+// when a login may be attempted.
+func LoginRetryAfter(keys ...string) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := database.DB.Where("`key` IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, t := range throttles {
+		if d := time.Until(*t.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login for key. Once the count reaches
+// maxAttempts within config.Current.Lockout.AttemptWindow the key is locked, and every
+// further failure doubles the lock, up to config.Current.Lockout.Max. The
+// count is only forgotten after a window without failures that starts when
+// the last lock ends, so locks longer than the window keep escalating.
+func RecordLoginFailure(key string, maxAttempts int) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var throttle models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&throttle).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		throttle = countLoginFailure(throttle, key, maxAttempts, now)
+		return tx.Save(&throttle).Error
+	})
+}
+
+// countLoginFailure returns t, or a new throttle when t is the zero value,
+// with one more failure at now and the lock that follows from it.
+func countLoginFailure(t models.LoginThrottle, key string, maxAttempts int, now time.Time) models.LoginThrottle {
+	if failuresExpired(t, now) {
+		// Locks are kept, but old failures no longer count.
+		t = models.LoginThrottle{Key: key, LockedUntil: t.LockedUntil}
+	}
+
+	t.Failures++
+	t.LastFailureAt = now
+	if t.Failures >= maxAttempts {
+		until := now.Add(lockoutDuration(t.Failures - maxAttempts))
+		t.LockedUntil = &until
+	}
+	return t
+}
+
+// failuresExpired reports whether the failures of t no longer count: the
+// attempt window has passed since the last failure and since the lock
+// ended.
+func failuresExpired(t models.LoginThrottle, now time.Time) bool {
+	since := t.LastFailureAt
+	if t.LockedUntil != nil && t.LockedUntil.After(since) {
+		since = *t.LockedUntil
+	}
+	return now.Sub(since) > config.Current.Lockout.AttemptWindow
+}
+
+// RecordLoginSuccess clears the failures of an account. IP counters are
+// kept so one valid account cannot be used to reset them.
+func RecordLoginSuccess(accountKey string) error {
+	return database.DB.Where("`key` = ?", accountKey).Delete(&models.LoginThrottle{}).Error
+}
+
+// ListLoginThrottles returns the keys whose failures still count: locked,
+// or locked or failed within the attempt window.
+func ListLoginThrottles() ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	since := time.Now().Add(-config.Current.Lockout.AttemptWindow)
+	err := database.DB.
+		Where("locked_until > ? OR last_failure_at > ?", since, since).
+		Order("last_failure_at DESC").
+		Find(&throttles).Error
+	return throttles, err
+}
+
+// UnlockLogin removes the failures and lock of key. It reports whether the
+// key had any.
+func UnlockLogin(key string) (bool, error) {
+	result := database.DB.Where("`key` = ?", key).Delete(&models.LoginThrottle{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// lockoutDuration is config.Current.Lockout.Base doubled for every failure past
+// the limit, capped at config.Current.Lockout.Max.
+func lockoutDuration(extraFailures int) time.Duration {
+	lock := config.Current.Lockout.Base
+	for i := 0; i < extraFailures && lock < config.Current.Lockout.Max; i++ {
+		lock *= 2
+	}
+	if lock > config.Current.Lockout.Max {
+		lock = config.Current.Lockout.Max
+	}
+	return lock
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/models"
+)
+
+func TestCountLoginFailureEscalation(t *testing.T) {
+	config.Current = config.Default() // 1m base lock, 1h max, 15m window
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// every returns n failure times, one second apart from offset.
+	every := func(offset time.Duration, n int) []time.Duration {
+		var at []time.Duration
+		for i := 0; i < n; i++ {
+			at = append(at, offset+time.Duration(i)*time.Second)
+		}
+		return at
+	}
+
+	tests := []struct {
+		name         string
+		failures     []time.Duration // offsets from start
+		wantFailures int
+		wantLock     time.Duration // after the last failure, 0 for unlocked
+	}{
+		{"below the limit", every(0, 4), 4, 0},
+		{"locks at the limit", every(0, 5), 5, time.Minute},
+		{"doubles per extra failure", every(0, 7), 7, 4 * time.Minute},
+		{"capped at the max", every(0, 12), 12, time.Hour},
+		{"forgotten after the window", append(every(0, 4), 16*time.Minute), 1, 0},
+		{
+			"lock longer than the window keeps escalating",
+			append(every(0, 12), 11*time.Second+time.Hour+time.Minute),
+			13, time.Hour,
+		},
+		{
+			"forgotten after the window that follows the lock",
+			append(every(0, 12), 11*time.Second+time.Hour+16*time.Minute),
+			1, 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var throttle models.LoginThrottle
+			var last time.Time
+			for _, offset := range tt.failures {
+				last = start.Add(offset)
+				throttle = countLoginFailure(throttle, "customer:a@example.com", 5, last)
+			}
+
+			if throttle.Key != "customer:a@example.com" {
+				t.Errorf("key = %q", throttle.Key)
+			}
+			if throttle.Failures != tt.wantFailures {
+				t.Errorf("failures = %d, want %d", throttle.Failures, tt.wantFailures)
+			}
+			var lock time.Duration
+			if throttle.LockedUntil != nil && throttle.LockedUntil.After(last) {
+				lock = throttle.LockedUntil.Sub(last)
+			}
+			if lock != tt.wantLock {
+				t.Errorf("lock = %v, want %v", lock, tt.wantLock)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/oidc"
+	"example.com/go-xampp-api/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidOIDCState is returned for unknown, used or expired login
+	// states.
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCNoRole is returned when the identity maps to no staff role.
+	ErrOIDCNoRole = errors.New("no staff role is granted to this identity")
+	// ErrOIDCEmailInUse is returned when another account already has the
+	// identity's email and it cannot be linked.
+	ErrOIDCEmailInUse = errors.New("email is already used by another account")
+	// ErrOIDCProvider wraps failures talking to the identity provider.
+	ErrOIDCProvider = errors.New("identity provider error")
+)
+
+var (
+	oidcProvider *oidc.Provider
+	oidcRoles    map[string]string // claim value -> role
+)
+
+// InitOIDC configures OpenID Connect login from the OIDC_* settings. It is
+// a no-op when OIDC_ISSUER is empty.
+func InitOIDC() error {
+	if config.Current.OIDC.Issuer == "" {
+		oidcProvider = nil
+		return nil
+	}
+	roles := map[string]string{}
+	for _, entry := range strings.Split(config.Current.OIDC.RoleMap, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		value, role, ok := strings.Cut(entry, "=")
+		if !ok || value == "" || !IsStaffRole(role) {
+			return fmt.Errorf("OIDC_ROLE_MAP: invalid entry %q, want claim-value=admin|staff", entry)
+		}
+		roles[value] = role
+	}
+
+	oidcRoles = roles
+	oidcProvider = oidc.NewProvider(oidc.Config{
+		Issuer:       config.Current.OIDC.Issuer,
+		ClientID:     config.Current.OIDC.ClientID,
+		ClientSecret: config.Current.OIDC.ClientSecret,
+		RedirectURL:  config.Current.OIDC.RedirectURL,
+		Scopes:       strings.Fields(config.Current.OIDC.Scopes),
+	})
+	return nil
+}
+
+// OIDCEnabled reports whether staff can log in through OpenID Connect.
+func OIDCEnabled() bool {
+	return oidcProvider != nil
+}
+
+// StartOIDCLogin stores a new login state and returns the identity
+// provider URL to redirect the browser to.
+func StartOIDCLogin(ctx context.Context) (string, error) {
+	state, stateHash, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.RandomHex(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := oidcProvider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	login := models.OIDCLoginState{
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(config.Current.OIDC.StateTTL),
+	}
+	if err := database.DB.Create(&login).Error; err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// FinishOIDCLogin handles the provider callback: it uses up the state,
+// exchanges the code, maps the claims to a role and returns the matching
+// user before and after the login, creating it on first login (before then
+// has ID 0). Disabled users get ErrUserDisabled.
+func FinishOIDCLogin(ctx context.Context, state, code string) (models.User, models.User, error) {
+	var login models.OIDCLoginState
+	err := database.DB.Where("state_hash = ?", HashToken(state)).First(&login).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, models.User{}, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return models.User{}, models.User{}, err
+	}
+	// Delete first so a state works only once, even for concurrent callbacks.
+	result := database.DB.Delete(&models.OIDCLoginState{}, login.ID)
+	if result.Error != nil {
+		return models.User{}, models.User{}, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(login.ExpiresAt) {
+		return models.User{}, models.User{}, ErrInvalidOIDCState
+	}
+
+	claims, err := oidcProvider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidIDToken) {
+			return models.User{}, models.User{}, err
+		}
+		return models.User{}, models.User{}, fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+
+	role := oidcRole(claims)
+	if role == "" {
+		return models.User{}, models.User{}, ErrOIDCNoRole
+	}
+	return provisionOIDCUser(claims, role)
+}
+
+// oidcRole returns the highest role granted by the role claim, or the
+// default role.
+func oidcRole(claims oidc.Claims) string {
+	role := ""
+	for _, value := range claims.StringValues(config.Current.OIDC.RoleClaim) {
+		switch oidcRoles[value] {
+		case models.RoleAdmin:
+			return models.RoleAdmin
+		case models.RoleStaff:
+			role = models.RoleStaff
+		}
+	}
+	if role == "" {
+		role = config.Current.OIDC.DefaultRole
+	}
+	return role
+}
+
+// provisionOIDCUser finds the user linked to the identity. An existing
+// user with the same verified email is linked on first login; otherwise a
+// new user is created. Disabled users get ErrUserDisabled and are left
+// unchanged. The role follows the identity provider, like a
+// role change by an admin: the user is signed out of other sessions, and
+// the last active admin keeps the role (ErrLastAdmin).
+func provisionOIDCUser(claims oidc.Claims, role string) (models.User, models.User, error) {
+	issuer := strings.TrimSuffix(config.Current.OIDC.Issuer, "/")
+	var before, user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("oidc_issuer = ? AND oidc_subject = ?", issuer, claims.Subject).First(&before).Error
+		if err == nil {
+			if before.DisabledAt != nil {
+				return ErrUserDisabled
+			}
+			user = before
+			if user.Role != role {
+				log.Printf("oidc: role of user %d changes from %s to %s", user.ID, user.Role, role)
+			}
+			return setUserRole(tx, &user, role)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if claims.Email == "" {
+			return fmt.Errorf("%w: no email claim", ErrOIDCProvider)
+		}
+		if claims.EmailVerified {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("email = ? AND oidc_subject IS NULL", claims.Email).First(&before).Error
+			if err == nil {
+				if before.DisabledAt != nil {
+					return ErrUserDisabled
+				}
+				log.Printf("oidc: linking user %d to %s", before.ID, claims.Subject)
+				user = before
+				user.OIDCIssuer, user.OIDCSubject = &issuer, &claims.Subject
+				if err := tx.Model(&user).Updates(map[string]interface{}{
+					"oidc_issuer":  issuer,
+					"oidc_subject": claims.Subject,
+				}).Error; err != nil {
+					return err
+				}
+				return setUserRole(tx, &user, role)
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ?", claims.Email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOIDCEmailInUse
+		}
+
+		username, err := freeUsername(tx, claims)
+		if err != nil {
+			return err
+		}
+		user = models.User{
+			Username:    username,
+			Email:       claims.Email,
+			Role:        role,
+			OIDCIssuer:  &issuer,
+			OIDCSubject: &claims.Subject,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		log.Printf("oidc: created user %d (%s) with role %s", user.ID, user.Username, role)
+		return nil
+	})
+	if err != nil {
+		return models.User{}, models.User{}, err
+	}
+	return before, user, nil
+}
+
+// freeUsername picks an unused username based on the preferred_username
+// or email claim.
+func freeUsername(tx *gorm.DB, claims oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if base == "" {
+		base = "user"
+	}
+	for i := 1; i <= 20; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s-%d", base, i)
+		}
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
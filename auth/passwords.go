@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"fmt"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"gorm.io/gorm"
+)
+
+// CheckNewPassword applies the password policy to a password the subject
+// wants to set. currentHash is the password being replaced; it and the
+// last PASSWORD_HISTORY passwords may not be chosen again. New accounts
+// pass subjectID 0 and an empty currentHash.
+func CheckNewPassword(subjectType string, subjectID uint, currentHash, password string) error {
+	if err := utils.ValidatePassword(password); err != nil {
+		return err
+	}
+	if config.Current.Password.History == 0 {
+		return nil
+	}
+
+	reused := fmt.Errorf("%w: must not match any of the last %d passwords", utils.ErrWeakPassword, config.Current.Password.History)
+	if currentHash != "" && utils.CheckPasswordHash(password, currentHash) {
+		return reused
+	}
+	if subjectID == 0 {
+		return nil
+	}
+
+	// The current password counts as one of the last N.
+	var history []models.PasswordHistory
+	err := database.DB.
+		Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("id DESC").
+		Limit(config.Current.Password.History - 1).
+		Find(&history).Error
+	if err != nil {
+		return err
+	}
+	for _, h := range history {
+		if utils.CheckPasswordHash(password, h.PasswordHash) {
+			return reused
+		}
+	}
+	return nil
+}
+
+// RecordPasswordChange remembers the replaced password hash and forgets
+// entries older than the configured history.
+func RecordPasswordChange(db *gorm.DB, subjectType string, subjectID uint, oldHash string) error {
+	if config.Current.Password.History <= 1 || oldHash == "" {
+		return nil
+	}
+	entry := models.PasswordHistory{SubjectType: subjectType, SubjectID: subjectID, PasswordHash: oldHash}
+	if err := db.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	var keep []uint
+	err := db.Model(&models.PasswordHistory{}).
+		Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("id DESC").
+		Limit(config.Current.Password.History-1).
+		Pluck("id", &keep).Error
+	if err != nil {
+		return err
+	}
+	return db.Where("subject_type = ? AND subject_id = ? AND id NOT IN ?", subjectType, subjectID, keep).
+		Delete(&models.PasswordHistory{}).Error
+}
+
+// UpgradePasswordHash stores a new hash of a password that was just
+// verified when the stored hash uses an old hasher or old parameters.
+// Failures are returned but never block the login.
+func UpgradePasswordHash(subjectType string, subjectID uint, password, hash string) error {
+	if !utils.NeedsRehash(hash) {
+		return nil
+	}
+	newHash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var model interface{} = &models.User{}
+	if subjectType == SubjectCustomer {
+		model = &models.Customer{}
+	}
+	// Only replace the hash that was verified, in case the password changed
+	// in the meantime.
+	return database.DB.Model(model).
+		Where("id = ? AND password = ?", subjectID, hash).
+		UpdateColumn("password", newHash).Error
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"gorm.io/gorm"
+)
+
+const phoneOTPDigits = 6
+
+// ErrInvalidPhoneOTP is returned for wrong, expired, used or exhausted
+// codes.
+var ErrInvalidPhoneOTP = errors.New("invalid or expired code")
+
+// IssuePhoneOTP creates a new code for phone (E.164) and returns it in
+// plain text for the SMS. Earlier codes stop working. When too many codes
+// were sent recently it returns the time to wait instead.
+func IssuePhoneOTP(phone string) (string, time.Duration, error) {
+	now := time.Now()
+	var sent []models.PhoneOTP
+	if err := database.DB.
+		Where("phone = ? AND created_at > ?", phone, now.Add(-24*time.Hour)).
+		Order("created_at DESC").
+		Find(&sent).Error; err != nil {
+		return "", 0, err
+	}
+	if len(sent) > 0 {
+		if wait := time.Until(sent[0].CreatedAt.Add(config.Current.Phone.OTPResendInterval)); wait > 0 {
+			return "", wait, nil
+		}
+	}
+	if len(sent) >= config.Current.Phone.OTPMaxPerDay {
+		oldest := sent[len(sent)-1]
+		return "", time.Until(oldest.CreatedAt.Add(24 * time.Hour)), nil
+	}
+
+	max := big.NewInt(1)
+	for range phoneOTPDigits {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", 0, err
+	}
+	code := fmt.Sprintf("%0*d", phoneOTPDigits, n)
+
+	if err := database.DB.Model(&models.PhoneOTP{}).
+		Where("phone = ? AND used_at IS NULL", phone).
+		Update("used_at", now).Error; err != nil {
+		return "", 0, err
+	}
+	otp := models.PhoneOTP{
+		Phone:     phone,
+		CodeHash:  hashPhoneOTP(phone, code),
+		ExpiresAt: now.Add(config.Current.Phone.OTPTTL),
+	}
+	if err := database.DB.Create(&otp).Error; err != nil {
+		return "", 0, err
+	}
+	return code, 0, nil
+}
+
+// VerifyPhoneOTP checks code against the latest code sent to phone. A
+// wrong code counts as an attempt; after PHONE_OTP_MAX_ATTEMPTS the code
+// stops working. With consume the code is used up, otherwise it stays
+// valid for the next step.
+func VerifyPhoneOTP(phone, code string, consume bool) error {
+	var otp models.PhoneOTP
+	err := database.DB.
+		Where("phone = ? AND used_at IS NULL AND expires_at > ?", phone, time.Now()).
+		Order("id DESC").
+		Limit(1).
+		Find(&otp).Error
+	if err != nil {
+		return err
+	}
+	if otp.ID == 0 {
+		return ErrInvalidPhoneOTP
+	}
+
+	// Take an attempt before comparing, in one conditional update, so
+	// concurrent guesses cannot all pass the limit. A right code gives it
+	// back, only wrong codes count.
+	result := database.DB.Model(&models.PhoneOTP{}).
+		Where("id = ? AND attempts < ?", otp.ID, config.Current.Phone.OTPMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidPhoneOTP
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPhoneOTP(phone, code)), []byte(otp.CodeHash)) != 1 {
+		return ErrInvalidPhoneOTP
+	}
+	if err := database.DB.Model(&models.PhoneOTP{}).
+		Where("id = ?", otp.ID).
+		UpdateColumn("attempts", gorm.Expr("attempts - 1")).Error; err != nil {
+		return err
+	}
+	if !consume {
+		return nil
+	}
+
+	// Conditional update: two requests with the same code cannot both win.
+	result = database.DB.Model(&models.PhoneOTP{}).
+		Where("id = ? AND used_at IS NULL", otp.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidPhoneOTP
+	}
+	return nil
+}
+
+// hashPhoneOTP binds the code to the phone number, so a code leaked for
+// one number is useless for another.
+func hashPhoneOTP(phone, code string) string {
+	return HashToken(phone + ":" + code)
+}
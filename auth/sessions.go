@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written for a
+// session that is used on every request.
+const sessionTouchInterval = time.Minute
+
+const maxUserAgentLength = 512
+
+// Client describes where a login or refresh came from.
+type Client struct {
+	IP        string
+	UserAgent string
+	Device    string // name sent by the app; derived from UserAgent when empty
+}
+
+// ListSessions returns the active sessions of a subject, newest first.
+func ListSessions(subjectType string, subjectID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.
+		Where("subject_type = ? AND subject_id = ? AND revoked_at IS NULL AND expires_at > ?", subjectType, subjectID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession ends one session. With a non-zero subjectID the session
+// must belong to that subject. It reports false when there is no such
+// active session.
+func RevokeSession(sessionID uint, subjectType string, subjectID uint) (bool, error) {
+	query := database.DB.Where("id = ? AND revoked_at IS NULL", sessionID)
+	if subjectID != 0 {
+		query = query.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID)
+	}
+
+	var session models.Session
+	if err := query.First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, revokeFamily(database.DB, session.FamilyID)
+}
+
+func startSession(db *gorm.DB, client Client, subjectType string, subjectID uint, familyID string) (models.Session, error) {
+	now := time.Now()
+	session := models.Session{
+		FamilyID:    familyID,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(config.Current.JWT.RefreshTTL),
+	}
+	client.apply(&session)
+	return session, db.Create(&session).Error
+}
+
+// touchSessionOnRefresh records the refresh on the family's session and
+// extends it. Families created before sessions existed get one now.
+func touchSessionOnRefresh(db *gorm.DB, client Client, familyID string) (models.Session, error) {
+	var session models.Session
+	err := db.Where("family_id = ?", familyID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var token models.RefreshToken
+		if err := db.Where("family_id = ?", familyID).First(&token).Error; err != nil {
+			return models.Session{}, err
+		}
+		return startSession(db, client, token.SubjectType, token.SubjectID, familyID)
+	}
+	if err != nil {
+		return models.Session{}, err
+	}
+	if session.RevokedAt != nil {
+		return models.Session{}, gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(config.Current.JWT.RefreshTTL)
+	client.apply(&session)
+	return session, db.Model(&session).Updates(map[string]interface{}{
+		"last_seen_at": session.LastSeenAt,
+		"expires_at":   session.ExpiresAt,
+		"ip":           session.IP,
+		"user_agent":   session.UserAgent,
+		"device":       session.Device,
+	}).Error
+}
+
+// sessionActive reports whether the session may still be used and updates
+// its last_seen_at at most once per sessionTouchInterval.
+func sessionActive(sessionID uint) (bool, error) {
+	var session models.Session
+	if err := database.DB.First(&session, sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return false, nil
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		err := database.DB.Model(&models.Session{}).
+			Where("id = ?", session.ID).
+			Update("last_seen_at", now).Error
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func generateSessionToken(subjectID uint, username, role string, sessionID uint) (utils.AccessToken, error) {
+	return utils.GenerateTokenWithClaims(subjectID, username, role, config.Current.JWT.AccessTTL, jwt.MapClaims{"sid": sessionID})
+}
+
+func (client Client) apply(session *models.Session) {
+	session.IP = client.IP
+	session.UserAgent = client.UserAgent
+	if len(session.UserAgent) > maxUserAgentLength {
+		session.UserAgent = session.UserAgent[:maxUserAgentLength]
+	}
+	session.Device = client.Device
+	if session.Device == "" {
+		session.Device = deviceFromUserAgent(client.UserAgent)
+	}
+}
+
+// deviceFromUserAgent gives a short, human readable device name.
+func deviceFromUserAgent(ua string) string {
+	platforms := []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Macintosh", "Mac"},
+		{"Linux", "Linux"},
+	}
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"Chrome/", "Chrome"},
+		{"Firefox/", "Firefox"},
+		{"Safari/", "Safari"},
+		{"okhttp", "Android app"},
+		{"Dart/", "Mobile app"},
+		{"curl/", "curl"},
+	}
+
+	var parts []string
+	for _, b := range browsers {
+		if strings.Contains(ua, b.token) {
+			parts = append(parts, b.name)
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(ua, p.token) {
+			parts = append(parts, p.name)
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return "Unknown device"
+	}
+	return strings.Join(parts, " on ")
+}
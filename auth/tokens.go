@@ -0,0 +1,348 @@
+// Package auth keeps the server-side authentication state: refresh tokens
+// and the revocation list checked by middleware.AuthMiddleware.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Subject types. Staff users and customers live in different tables, so
+// server-side token state is keyed by subject type and id.
+const (
+	SubjectUser     = "user"
+	SubjectCustomer = "customer"
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired, revoked or reused
+// refresh tokens.
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// ErrTwoFactorRequired is returned by Refresh for staff without 2FA while
+// the security policy requires it. They have to log in again, which asks
+// them to set up 2FA.
+var ErrTwoFactorRequired = errors.New("two-factor authentication is required, log in again to set it up")
+
+// TokenPair is what a successful login or refresh returns to the client.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // access token lifetime in seconds
+}
+
+// SubjectTypeForRole maps a token role to the table the subject lives in.
+func SubjectTypeForRole(role string) string {
+	if role == "customer" {
+		return SubjectCustomer
+	}
+	return SubjectUser
+}
+
+// IssueTokens starts a new login: a session, an access token and the first
+// refresh token of a new token family.
+func IssueTokens(client Client, subjectID uint, username, role string) (TokenPair, error) {
+	familyID, err := utils.RandomHex(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	session, err := startSession(database.DB, client, SubjectTypeForRole(role), subjectID, familyID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refresh, _, err := createRefreshToken(database.DB, SubjectTypeForRole(role), subjectID, familyID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	access, err := generateSessionToken(subjectID, username, role, session.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access.Token,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(config.Current.JWT.AccessTTL.Seconds()),
+	}, nil
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and
+// replaced by a new one in the same family. Presenting a token that was
+// already rotated revokes the whole family, since it means the token was
+// copied.
+func Refresh(client Client, plain string) (TokenPair, error) {
+	tx := database.DB.Begin()
+
+	var current models.RefreshToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", HashToken(plain)).
+		First(&current).Error
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return TokenPair{}, ErrInvalidRefreshToken
+		}
+		return TokenPair{}, err
+	}
+
+	if current.RevokedAt != nil {
+		if err := revokeFamily(tx, current.FamilyID); err != nil {
+			tx.Rollback()
+			return TokenPair{}, err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		tx.Rollback()
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	revoked, err := subjectRevokedSince(tx, current.SubjectType, current.SubjectID, current.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return TokenPair{}, err
+	}
+	if revoked {
+		tx.Rollback()
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	username, role, err := loadSubject(tx, current.SubjectType, current.SubjectID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return TokenPair{}, ErrInvalidRefreshToken
+		}
+		return TokenPair{}, err
+	}
+
+	session, err := touchSessionOnRefresh(tx, client, current.FamilyID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return TokenPair{}, ErrInvalidRefreshToken
+		}
+		return TokenPair{}, err
+	}
+
+	refresh, next, err := createRefreshToken(tx, current.SubjectType, current.SubjectID, current.FamilyID)
+	if err != nil {
+		tx.Rollback()
+		return TokenPair{}, err
+	}
+	if err := tx.Model(&current).Updates(map[string]interface{}{
+		"revoked_at":     time.Now(),
+		"replaced_by_id": next.ID,
+	}).Error; err != nil {
+		tx.Rollback()
+		return TokenPair{}, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return TokenPair{}, err
+	}
+
+	access, err := generateSessionToken(current.SubjectID, username, role, session.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access.Token,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(config.Current.JWT.AccessTTL.Seconds()),
+	}, nil
+}
+
+// RevokeAccessToken puts an access token on the revocation list until it
+// expires.
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// RevokeRefreshToken revokes the family of the given refresh token. Unknown
+// tokens are ignored.
+func RevokeRefreshToken(plain string) error {
+	var token models.RefreshToken
+	err := database.DB.Where("token_hash = ?", HashToken(plain)).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return revokeFamily(database.DB, token.FamilyID)
+}
+
+// RevokeSubject invalidates every access and refresh token issued to the
+// subject so far.
+func RevokeSubject(db *gorm.DB, subjectType string, subjectID uint) error {
+	now := time.Now()
+	err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&models.SubjectRevocation{
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		RevokedAt:   now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := db.Model(&models.Session{}).
+		Where("subject_type = ? AND subject_id = ? AND revoked_at IS NULL", subjectType, subjectID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.RefreshToken{}).
+		Where("subject_type = ? AND subject_id = ? AND revoked_at IS NULL", subjectType, subjectID).
+		Update("revoked_at", now).Error
+}
+
+// IsRevoked reports whether an access token must be rejected, either
+// because its jti or its session was revoked or because all tokens of its
+// subject issued before a point in time were revoked. Tokens without a
+// session (sessionID 0) are only checked by jti and subject.
+func IsRevoked(jti string, subjectType string, subjectID uint, sessionID uint, issuedAt time.Time) (bool, error) {
+	var count int64
+	if err := database.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+	if sessionID != 0 {
+		active, err := sessionActive(sessionID)
+		if err != nil || !active {
+			return true, err
+		}
+	}
+	return subjectRevokedSince(database.DB, subjectType, subjectID, issuedAt)
+}
+
+// PurgeExpired deletes revocation entries, sessions and refresh tokens that
+// can no longer be used anyway.
+func PurgeExpired(ctx context.Context) error {
+	now := time.Now()
+	if err := database.DB.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	if err := database.DB.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+	if err := database.DB.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return err
+	}
+	// SMS codes are kept for a day because they count towards the daily limit.
+	if err := database.DB.WithContext(ctx).Where("created_at < ?", now.Add(-24*time.Hour)).Delete(&models.PhoneOTP{}).Error; err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error
+}
+
+// NewOpaqueToken returns a random URL-safe token and the hash to store.
+func NewOpaqueToken() (plain string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	plain = base64.RawURLEncoding.EncodeToString(b)
+	return plain, HashToken(plain), nil
+}
+
+// HashToken hashes an opaque token for storage and lookup.
+func HashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func createRefreshToken(db *gorm.DB, subjectType string, subjectID uint, familyID string) (string, models.RefreshToken, error) {
+	plain, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+	token := models.RefreshToken{
+		TokenHash:   hash,
+		FamilyID:    familyID,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		ExpiresAt:   time.Now().Add(config.Current.JWT.RefreshTTL),
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return "", models.RefreshToken{}, err
+	}
+	return plain, token, nil
+}
+
+// revokeFamily ends the session of a token family: its refresh tokens stop
+// working and so do its access tokens.
+func revokeFamily(db *gorm.DB, familyID string) error {
+	now := time.Now()
+	if err := db.Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+// subjectRevokedSince reports whether the subject's tokens issued at
+// issuedAt were revoked. Revocation has second precision, like the iat
+// claim, and a token issued in the same second as the revocation survives
+// so that a fresh login right after a password change keeps working.
+func subjectRevokedSince(db *gorm.DB, subjectType string, subjectID uint, issuedAt time.Time) (bool, error) {
+	var revocation models.SubjectRevocation
+	err := db.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).First(&revocation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return issuedAt.Unix() < revocation.RevokedAt.Unix(), nil
+}
+
+// loadSubject returns the current username and role of a subject.
+// Disabled users get ErrInvalidRefreshToken.
+func loadSubject(db *gorm.DB, subjectType string, subjectID uint) (string, string, error) {
+	if subjectType == SubjectCustomer {
+		var customer models.Customer
+		if err := db.First(&customer, subjectID).Error; err != nil {
+			return "", "", err
+		}
+		return customer.LoginName(), "customer", nil
+	}
+
+	var user models.User
+	if err := db.First(&user, subjectID).Error; err != nil {
+		return "", "", err
+	}
+	if user.DisabledAt != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if user.TOTPEnabledAt == nil {
+		policy, err := GetSecurityPolicy()
+		if err != nil {
+			return "", "", err
+		}
+		if policy.RequireStaff2FA {
+			return "", "", ErrTwoFactorRequired
+		}
+	}
+	return user.Username, user.Role, nil
+}
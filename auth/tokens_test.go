@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points database.DB at a fresh SQLite database with the tables
+// the token functions use.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	config.Current = config.Default()
+	if err := utils.InitJWTKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.User{}, &models.Customer{}, &models.RefreshToken{},
+		&models.Session{}, &models.SubjectRevocation{}, &models.SecurityPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+func TestRefreshReuse(t *testing.T) {
+	// Each step presents a refresh token by index: 0 is the one from login,
+	// every successful refresh appends the token it returns.
+	type step struct {
+		use     int
+		wantErr error
+	}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, userID uint)
+		steps []step
+	}{
+		{
+			name:  "rotated tokens work once each",
+			steps: []step{{0, nil}, {1, nil}, {2, nil}},
+		},
+		{
+			name:  "reused token is rejected",
+			steps: []step{{0, nil}, {0, ErrInvalidRefreshToken}},
+		},
+		{
+			name:  "reuse revokes the whole family",
+			steps: []step{{0, nil}, {1, nil}, {0, ErrInvalidRefreshToken}, {2, ErrInvalidRefreshToken}},
+		},
+		{
+			name: "revoked subject",
+			setup: func(t *testing.T, userID uint) {
+				if err := RevokeSubject(database.DB, SubjectUser, userID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			steps: []step{{0, ErrInvalidRefreshToken}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			user := models.User{Username: "staff", Email: "staff@example.com", Password: "x", Role: models.RoleStaff}
+			if err := database.DB.Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			login, err := IssueTokens(Client{}, user.ID, user.Username, user.Role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, user.ID)
+			}
+
+			tokens := []string{login.RefreshToken}
+			for i, s := range tt.steps {
+				pair, err := Refresh(Client{}, tokens[s.use])
+				if !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d: refresh token %d: err = %v, want %v", i, s.use, err, s.wantErr)
+				}
+				if err == nil {
+					tokens = append(tokens, pair.RefreshToken)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		useTestDB(t)
+		if _, err := Refresh(Client{}, "not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("err = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+	})
+}
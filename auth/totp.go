@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator
+// app understands.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // accept codes one step before or after the current one
+
+	recoveryCodeCount = 10
+)
+
+// PurposeTOTPEnrollment marks the restricted token given to staff who must
+// enroll in 2FA before they can log in.
+const PurposeTOTPEnrollment = "2fa_enrollment"
+
+// ErrInvalidTOTPCode is returned for wrong, expired or replayed codes.
+var ErrInvalidTOTPCode = errors.New("invalid two-factor code")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret in base32.
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI to render as a QR code.
+func TOTPProvisioningURI(secret, account string) string {
+	label := url.PathEscape(config.Current.Auth.TOTPIssuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", config.Current.Auth.TOTPIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// MatchTOTP checks code against secret at time now. It returns the matched
+// time step, which must be greater than lastStep so a code cannot be used
+// twice.
+func MatchTOTP(secret, code string, lastStep int64, now time.Time) (int64, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, err
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return 0, ErrInvalidTOTPCode
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidTOTPCode
+}
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// IssueTOTPEnrollmentToken returns a short-lived token that only works on
+// the 2FA enrollment endpoints.
+func IssueTOTPEnrollmentToken(user models.User) (utils.AccessToken, error) {
+	return utils.GenerateTokenWithClaims(user.ID, user.Username, user.Role, config.Current.Auth.TwoFactorTokenTTL,
+		jwt.MapClaims{"purpose": PurposeTOTPEnrollment})
+}
+
+// VerifyUserTOTP checks a code against the user's enabled secret and
+// remembers the step so it cannot be replayed.
+func VerifyUserTOTP(user *models.User, code string) error {
+	if user.TOTPEnabledAt == nil {
+		return ErrInvalidTOTPCode
+	}
+	step, err := MatchTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+	if err != nil {
+		return ErrInvalidTOTPCode
+	}
+
+	// Conditional update: two requests with the same code cannot both win.
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes with new ones
+// and returns them in plain text. They are shown to the user only once.
+func GenerateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: HashToken(code)})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks one of the user's unused recovery codes as used.
+func UseRecoveryCode(userID uint, code string) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes.
+func RemainingRecoveryCodes(userID uint) (int64, error) {
+	var n int64
+	err := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&n).Error
+	return n, err
+}
+
+// GetSecurityPolicy returns the current policy, or the defaults when no
+// admin has changed it yet.
+func GetSecurityPolicy() (models.SecurityPolicy, error) {
+	var policy models.SecurityPolicy
+	err := database.DB.Where("id = ?", 1).Limit(1).Find(&policy).Error
+	policy.ID = 1
+	return policy, err
+}
+
+// SaveSecurityPolicy stores the policy row.
+func SaveSecurityPolicy(policy models.SecurityPolicy) error {
+	policy.ID = 1
+	return database.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&policy).Error
+}
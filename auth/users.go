@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUserDisabled is returned when a disabled staff user tries to log
+	// in.
+	ErrUserDisabled = errors.New("account is disabled")
+	// ErrLastAdmin is returned when a change would leave no active admin.
+	ErrLastAdmin = errors.New("the last active admin cannot be disabled, demoted or deleted")
+)
+
+// UserDisabled reports whether a staff user was disabled or deleted.
+func UserDisabled(userID uint) (bool, error) {
+	var user models.User
+	err := database.DB.Select("id", "disabled_at").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.DisabledAt != nil, nil
+}
+
+// SetUserDisabled disables or enables a staff user and returns the user
+// before and after the change. Disabling signs the user out everywhere.
+func SetUserDisabled(userID uint, disabled bool) (models.User, models.User, error) {
+	return changeUser(userID, func(tx *gorm.DB, user *models.User) error {
+		if !disabled {
+			user.DisabledAt = nil
+			return tx.Model(user).Update("disabled_at", nil).Error
+		}
+		if user.DisabledAt != nil {
+			return nil
+		}
+		if err := guardLastAdmin(tx, *user); err != nil {
+			return err
+		}
+		now := time.Now()
+		user.DisabledAt = &now
+		if err := tx.Model(user).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		return RevokeSubject(tx, SubjectUser, user.ID)
+	})
+}
+
+// ChangeUserRole gives a staff user a new role. The role is part of the
+// access token, so the user is signed out and gets it on the next login.
+func ChangeUserRole(userID uint, role string) (models.User, models.User, error) {
+	return changeUser(userID, func(tx *gorm.DB, user *models.User) error {
+		return setUserRole(tx, user, role)
+	})
+}
+
+// setUserRole changes the role of a locked user and signs them out
+// everywhere. The last active admin cannot lose the admin role.
+func setUserRole(tx *gorm.DB, user *models.User, role string) error {
+	if user.Role == role {
+		return nil
+	}
+	if role != models.RoleAdmin {
+		if err := guardLastAdmin(tx, *user); err != nil {
+			return err
+		}
+	}
+	user.Role = role
+	if err := tx.Model(user).Update("role", role).Error; err != nil {
+		return err
+	}
+	return RevokeSubject(tx, SubjectUser, user.ID)
+}
+
+// ResetUserPassword clears the password of a staff user, signs them out
+// everywhere and returns a password reset token for the link the user
+// chooses a new password with.
+func ResetUserPassword(userID uint) (models.User, string, error) {
+	var token string
+	user, _, err := changeUser(userID, func(tx *gorm.DB, user *models.User) error {
+		oldHash := user.Password
+		if err := tx.Model(user).Update("password", "").Error; err != nil {
+			return err
+		}
+		if err := RecordPasswordChange(tx, SubjectUser, user.ID, oldHash); err != nil {
+			return err
+		}
+		if err := RevokeSubject(tx, SubjectUser, user.ID); err != nil {
+			return err
+		}
+		var err error
+		token, err = CreateActionToken(tx, models.ActionPasswordReset, SubjectUser, user.ID, config.Current.Auth.PasswordResetTTL)
+		return err
+	})
+	return user, token, err
+}
+
+// DeleteUser deletes a staff user with their recovery codes, pending
+// tokens and password history, and signs them out everywhere. Audit
+// entries, invites and API keys keep the user's ID.
+func DeleteUser(userID uint) (models.User, error) {
+	before, _, err := changeUser(userID, func(tx *gorm.DB, user *models.User) error {
+		if err := guardLastAdmin(tx, *user); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.ActionToken{}, &models.PasswordHistory{}} {
+			if err := tx.Where("subject_type = ? AND subject_id = ?", SubjectUser, user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&models.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		return RevokeSubject(tx, SubjectUser, user.ID)
+	})
+	return before, err
+}
+
+// changeUser locks a staff user and applies change in a transaction. It
+// returns gorm.ErrRecordNotFound for unknown users.
+func changeUser(userID uint, change func(tx *gorm.DB, user *models.User) error) (models.User, models.User, error) {
+	var before, after models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, userID).Error; err != nil {
+			return err
+		}
+		after = before
+		return change(tx, &after)
+	})
+	return before, after, err
+}
+
+// guardLastAdmin returns ErrLastAdmin when user is the only active admin.
+// The active admins are locked, so two admins cannot demote each other at
+// the same time.
+func guardLastAdmin(tx *gorm.DB, user models.User) error {
+	if user.Role != models.RoleAdmin || user.DisabledAt != nil {
+		return nil
+	}
+	var ids []uint
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Model(&models.User{}).
+		Where("role = ? AND disabled_at IS NULL", models.RoleAdmin).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id != user.ID {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
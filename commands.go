@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/oidc"
+	"example.com/go-xampp-api/utils"
+	"gorm.io/gorm"
+)
+
+// runCommand runs a one-off command instead of the server and returns the
+// process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "bootstrap-admin":
+		return bootstrapAdmin(args[1:])
+	case "mock-idp":
+		return mockIDP(args[1:])
+	case "migrate":
+		return migrate(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\ncommands:\n  bootstrap-admin  create the first admin user\n  mock-idp         run a local OpenID Connect provider for testing\n  migrate          show, apply, roll back or create database migrations\n", args[0])
+		return 2
+	}
+}
+
+// migrate manages the versioned schema migrations in database/migrations:
+//
+//	go run . migrate status
+//	go run . migrate up [-to 3]
+//	go run . migrate down [-steps 1]
+//	go run . migrate create add_product_sku
+func migrate(args []string) int {
+	usage := "usage: migrate status | up [-to version] | down [-steps n] | create <name>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	to := fs.Uint("to", 0, "apply migrations up to this version (default: all)")
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	dir := fs.String("dir", "database/migrations", "directory for new migration files")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if args[0] == "create" {
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: migrate create <name>")
+			return 2
+		}
+		paths, err := database.CreateMigration(*dir, fs.Arg(0))
+		for _, p := range paths {
+			fmt.Println("created", p)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		fmt.Println("rebuild the binary to embed the new migration")
+		return 0
+	}
+
+	if err := config.Init(nil); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	db, err := database.Open()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate: cannot connect database:", err)
+		return 1
+	}
+	defer func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	switch args[0] {
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		for _, s := range states {
+			status := "pending"
+			if s.AppliedAt != nil {
+				status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+				if s.Up == "" {
+					status += " (not in this build)"
+				}
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, status)
+		}
+		return 0
+	case "up":
+		applied, err := database.MigrateUp(db, *to)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return 0
+	case "down":
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "migrate: -steps must be at least 1")
+			return 2
+		}
+		reverted, err := database.MigrateDown(db, *steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to roll back")
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+// bootstrapAdmin creates the first admin. It refuses to run once any user
+// exists; further staff join through invites.
+//
+//	go run . bootstrap-admin -username admin -email admin@example.com
+//
+// The password is read from BOOTSTRAP_ADMIN_PASSWORD, or generated and
+// printed once when that is empty.
+func bootstrapAdmin(args []string) int {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	username := fs.String("username", "admin", "username of the first admin")
+	email := fs.String("email", "", "email of the first admin (required)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "bootstrap-admin: -email is required")
+		return 2
+	}
+
+	if err := config.Init(nil); err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap-admin:", err)
+		return 1
+	}
+	if err := utils.InitPasswordPolicy(); err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap-admin:", err)
+		return 1
+	}
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = utils.RandomHex(12); err != nil {
+			fmt.Fprintln(os.Stderr, "bootstrap-admin:", err)
+			return 1
+		}
+	} else if err := utils.ValidatePassword(password); err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap-admin: BOOTSTRAP_ADMIN_PASSWORD:", err)
+		return 2
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap-admin:", err)
+		return 1
+	}
+
+	database.InitDB()
+
+	user := models.User{
+		Username: *username,
+		Email:    *email,
+		Password: hashedPassword,
+		Role:     models.RoleAdmin,
+	}
+	errUsersExist := errors.New("users already exist, invite new staff from an admin account instead")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUsersExist
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap-admin:", err)
+		return 1
+	}
+
+	fmt.Printf("created admin %q (id %d)\n", user.Username, user.ID)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+	return 0
+}
+
+// mockIDP runs a local OpenID Connect provider that approves every login,
+// for trying out OIDC staff login without a real identity provider:
+//
+//	go run . mock-idp -addr :9000 -groups rice-admins
+//	OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=rice-api OIDC_ROLE_MAP=rice-admins=admin go run .
+//
+// Open /auth/oidc/login in a browser; add ?login_hint=someone@example.com
+// to the provider's /authorize URL to log in as another identity.
+func mockIDP(args []string) int {
+	fs := flag.NewFlagSet("mock-idp", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:9000", "listen address")
+	issuer := fs.String("issuer", "", "issuer URL (default: http://<addr>)")
+	sub := fs.String("sub", "mock-user-1", "sub claim")
+	email := fs.String("email", "staff@example.com", "email claim")
+	name := fs.String("name", "Mock Staff", "name claim")
+	groups := fs.String("groups", "rice-staff", "comma separated groups claim")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+
+	groupList := []string{}
+	for _, g := range strings.Split(*groups, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groupList = append(groupList, g)
+		}
+	}
+	provider, err := oidc.NewMockProvider(*issuer, map[string]interface{}{
+		"sub":                *sub,
+		"email":              *email,
+		"email_verified":     true,
+		"name":               *name,
+		"preferred_username": strings.SplitN(*email, "@", 2)[0],
+		"groups":             groupList,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mock-idp:", err)
+		return 1
+	}
+
+	fmt.Printf("mock OpenID Connect provider at %s\n", *issuer)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		fmt.Fprintln(os.Stderr, "mock-idp:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+// Package config holds every setting of the API in one typed struct. Init
+// loads it from the defaults, an optional YAML or TOML file, environment
+// variables and command line flags, in that order, and validates it.
+//
+// Each setting has a key in the file ("jwt.access_ttl"), a flag with the
+// same name (-jwt.access_ttl=30m) and an environment variable
+// (JWT_ACCESS_TTL). Durations use Go syntax ("15m", "48h") and lists are
+// comma separated in the environment and in flags.
+package config
+
+import "time"
+
+// DefaultJWTSecret is the HS256 secret used when none is configured. It is
+// refused outside development.
+const DefaultJWTSecret = "my-secret-key-change-in-production"
+
+// Config is the complete configuration.
+type Config struct {
+	Env string `key:"env" env:"APP_ENV"` // insecure defaults are only allowed in "development"
+
+	Server            Server            `key:"server"`
+	Database          Database          `key:"database"`
+	JWT               JWT               `key:"jwt"`
+	Uploads           Uploads           `key:"uploads"`
+	CORS              CORS              `key:"cors"`
+	Auth              Auth              `key:"auth"`
+	Lockout           Lockout           `key:"lockout"`
+	EmailVerification EmailVerification `key:"email_verification"`
+	Phone             Phone             `key:"phone"`
+	Password          Password          `key:"password"`
+	OIDC              OIDC              `key:"oidc"`
+	Notify            Notify            `key:"notify"`
+	AbandonedCart     AbandonedCart     `key:"abandoned_cart"`
+}
+
+// Server is the HTTP listener.
+type Server struct {
+	Addr              string        `key:"addr" env:"SERVER_ADDR"`
+	ReadTimeout       time.Duration `key:"read_timeout" env:"SERVER_READ_TIMEOUT"` // whole request including the body
+	ReadHeaderTimeout time.Duration `key:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `key:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `key:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"` // keep-alive connections
+	MaxHeaderBytes    int           `key:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+	MaxBodyBytes      int64         `key:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES"`     // larger requests get 413
+	ShutdownTimeout   time.Duration `key:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"` // how long SIGTERM waits for open requests, jobs and notifications
+}
+
+// Database is the MySQL connection.
+type Database struct {
+	User     string `key:"user" env:"DB_USER"`
+	Password string `key:"password" env:"DB_PASS"`
+	Host     string `key:"host" env:"DB_HOST"` // an IP, so the driver does not pick the unix socket for "localhost"
+	Port     int    `key:"port" env:"DB_PORT"`
+	Name     string `key:"name" env:"DB_NAME"`
+
+	MigrateOnStart bool `key:"migrate_on_start" env:"DB_MIGRATE_ON_START"` // apply pending migrations at startup instead of refusing to start
+}
+
+// JWT is how access tokens are signed and how long tokens live.
+type JWT struct {
+	Alg            string        `key:"alg" env:"JWT_ALG"` // HS256, RS256 or EdDSA
+	Secret         string        `key:"secret" env:"JWT_SECRET"`
+	SigningKeyFile string        `key:"signing_key_file" env:"JWT_SIGNING_KEY_FILE"` // PEM private key for RS256/EdDSA
+	KeyID          string        `key:"key_id" env:"JWT_KEY_ID"`                     // default: JWK thumbprint
+	VerifyKeyFiles []string      `key:"verify_key_files" env:"JWT_VERIFY_KEY_FILES"` // old public keys, optionally kid=path
+	AccessTTL      time.Duration `key:"access_ttl" env:"JWT_ACCESS_TTL"`
+	RefreshTTL     time.Duration `key:"refresh_ttl" env:"JWT_REFRESH_TTL"`
+}
+
+// Uploads are the product images.
+type Uploads struct {
+	Dir          string   `key:"dir" env:"UPLOAD_DIR"`
+	MaxBytes     int64    `key:"max_bytes" env:"UPLOAD_MAX_BYTES"`
+	AllowedTypes []string `key:"allowed_types" env:"UPLOAD_ALLOWED_TYPES"` // detected from the content, not the file name
+}
+
+// CORS controls which browser origins may call the API.
+type CORS struct {
+	AllowedOrigins   []string `key:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`     // "*" allows every origin
+	AllowCredentials bool     `key:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"` // needs explicit origins, browsers refuse it with "*"
+}
+
+// Auth holds the lifetimes and front-end links of one-off tokens.
+type Auth struct {
+	PasswordResetTTL  time.Duration `key:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+	PasswordResetURL  string        `key:"password_reset_url" env:"PASSWORD_RESET_URL"`
+	InviteTTL         time.Duration `key:"invite_ttl" env:"INVITE_TTL"`
+	InviteURL         string        `key:"invite_url" env:"INVITE_URL"`
+	TOTPIssuer        string        `key:"totp_issuer" env:"TOTP_ISSUER"`
+	TwoFactorTokenTTL time.Duration `key:"two_factor_token_ttl" env:"TWO_FACTOR_TOKEN_TTL"` // challenge and enrollment tokens
+	ImpersonationTTL  time.Duration `key:"impersonation_ttl" env:"IMPERSONATION_TTL"`
+}
+
+// Lockout is the login brute-force protection: accounts and IPs are locked
+// after too many failures, for longer on every further failure.
+type Lockout struct {
+	MaxAttemptsPerAccount int           `key:"max_attempts_account" env:"LOGIN_MAX_ATTEMPTS_ACCOUNT"`
+	MaxAttemptsPerIP      int           `key:"max_attempts_ip" env:"LOGIN_MAX_ATTEMPTS_IP"`
+	AttemptWindow         time.Duration `key:"attempt_window" env:"LOGIN_ATTEMPT_WINDOW"`
+	Base                  time.Duration `key:"base" env:"LOGIN_LOCKOUT_BASE"`
+	Max                   time.Duration `key:"max" env:"LOGIN_LOCKOUT_MAX"`
+}
+
+// EmailVerification is the customer email verification.
+type EmailVerification struct {
+	TTL               time.Duration `key:"ttl" env:"EMAIL_VERIFICATION_TTL"`
+	URL               string        `key:"url" env:"EMAIL_VERIFICATION_URL"`
+	ResendInterval    time.Duration `key:"resend_interval" env:"EMAIL_VERIFICATION_RESEND_INTERVAL"`
+	MaxPerDay         int           `key:"max_per_day" env:"EMAIL_VERIFICATION_MAX_PER_DAY"`
+	RequiredForOrders bool          `key:"required_for_orders" env:"REQUIRE_VERIFIED_EMAIL_FOR_ORDERS"`
+}
+
+// Phone is the customer login with SMS codes.
+type Phone struct {
+	DefaultCountryCode string        `key:"default_country_code" env:"PHONE_DEFAULT_COUNTRY_CODE"`
+	OTPTTL             time.Duration `key:"otp_ttl" env:"PHONE_OTP_TTL"`
+	OTPMaxAttempts     int           `key:"otp_max_attempts" env:"PHONE_OTP_MAX_ATTEMPTS"` // wrong codes before a code stops working
+	OTPResendInterval  time.Duration `key:"otp_resend_interval" env:"PHONE_OTP_RESEND_INTERVAL"`
+	OTPMaxPerDay       int           `key:"otp_max_per_day" env:"PHONE_OTP_MAX_PER_DAY"`
+}
+
+// Password is the password hasher and policy.
+type Password struct {
+	Hasher            string `key:"hasher" env:"PASSWORD_HASHER"` // bcrypt or argon2id
+	BcryptCost        int    `key:"bcrypt_cost" env:"BCRYPT_COST"`
+	Argon2Memory      int    `key:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB"`
+	Argon2Iterations  int    `key:"argon2_iterations" env:"ARGON2_ITERATIONS"`
+	Argon2Parallelism int    `key:"argon2_parallelism" env:"ARGON2_PARALLELISM"`
+	MinLength         int    `key:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	History           int    `key:"history" env:"PASSWORD_HISTORY"` // 0 disables the reuse check
+	BreachedListFile  string `key:"breached_list_file" env:"PASSWORD_BREACHED_LIST_FILE"`
+}
+
+// OIDC is the OpenID Connect login for staff, off while Issuer is empty.
+type OIDC struct {
+	Issuer       string        `key:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string        `key:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string        `key:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string        `key:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes       string        `key:"scopes" env:"OIDC_SCOPES"`
+	RoleClaim    string        `key:"role_claim" env:"OIDC_ROLE_CLAIM"`
+	RoleMap      string        `key:"role_map" env:"OIDC_ROLE_MAP"`         // e.g. "rice-admins=admin,rice-staff=staff"
+	DefaultRole  string        `key:"default_role" env:"OIDC_DEFAULT_ROLE"` // role when no mapping matches; empty refuses the login
+	SuccessURL   string        `key:"success_url" env:"OIDC_SUCCESS_URL"`   // front-end page that gets the tokens in the URL fragment
+	StateTTL     time.Duration `key:"state_ttl" env:"OIDC_STATE_TTL"`
+	TrustIdPMFA  bool          `key:"trust_idp_mfa" env:"OIDC_TRUST_IDP_MFA"` // skip the local 2FA step; only if the provider enforces MFA
+}
+
+// Notify selects how emails and SMS are delivered.
+type Notify struct {
+	Sender       string `key:"sender" env:"NOTIFY_SENDER"`         // log, file or smtp
+	OutboxDir    string `key:"outbox_dir" env:"NOTIFY_OUTBOX_DIR"` // used by the file sender
+	SMTPAddr     string `key:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPUsername string `key:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `key:"smtp_password" env:"SMTP_PASSWORD"`
+	SMTPFrom     string `key:"smtp_from" env:"SMTP_FROM"`
+	SMSSender    string `key:"sms_sender" env:"SMS_SENDER"` // log only
+}
+
+// AbandonedCart controls the abandoned cart reminder job.
+type AbandonedCart struct {
+	Enabled     bool          `key:"enabled" env:"ABANDONED_CART_REMINDERS"`
+	After       time.Duration `key:"after" env:"ABANDONED_CART_AFTER"`       // how long a cart must stay unchanged
+	Interval    time.Duration `key:"interval" env:"ABANDONED_CART_INTERVAL"` // how often the job runs
+	BatchSize   int           `key:"batch_size" env:"ABANDONED_CART_BATCH_SIZE"`
+	MaxAttempts int           `key:"max_attempts" env:"ABANDONED_CART_MAX_ATTEMPTS"`
+	CartURL     string        `key:"cart_url" env:"ABANDONED_CART_URL"`
+}
+
+// Current is the configuration in use. It holds the defaults until Init
+// replaces it at startup.
+var Current = Default()
+
+// Default returns the built-in settings, suitable for local development
+// with XAMPP once APP_ENV=development is set. Env defaults to production so
+// a deploy that forgets APP_ENV refuses the default JWT secret.
+func Default() *Config {
+	return &Config{
+		Env: "production",
+		Server: Server{
+			Addr:              ":8081",
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      10 << 20,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			User: "root",
+			Host: "127.0.0.1",
+			Port: 3306,
+			Name: "go_api_db",
+		},
+		JWT: JWT{
+			Alg:        "HS256",
+			Secret:     DefaultJWTSecret,
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 720 * time.Hour,
+		},
+		Uploads: Uploads{
+			Dir:          "uploads",
+			MaxBytes:     5 << 20,
+			AllowedTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+		},
+		CORS: CORS{
+			AllowedOrigins: []string{"*"},
+		},
+		Auth: Auth{
+			PasswordResetTTL:  time.Hour,
+			PasswordResetURL:  "http://localhost:3000/reset-password",
+			InviteTTL:         72 * time.Hour,
+			InviteURL:         "http://localhost:3000/register",
+			TOTPIssuer:        "Rice API",
+			TwoFactorTokenTTL: 10 * time.Minute,
+			ImpersonationTTL:  15 * time.Minute,
+		},
+		Lockout: Lockout{
+			MaxAttemptsPerAccount: 5,
+			MaxAttemptsPerIP:      20,
+			AttemptWindow:         15 * time.Minute,
+			Base:                  time.Minute,
+			Max:                   time.Hour,
+		},
+		EmailVerification: EmailVerification{
+			TTL:            48 * time.Hour,
+			URL:            "http://localhost:3000/verify-email",
+			ResendInterval: time.Minute,
+			MaxPerDay:      5,
+		},
+		Phone: Phone{
+			DefaultCountryCode: "856", // Laos
+			OTPTTL:             5 * time.Minute,
+			OTPMaxAttempts:     5,
+			OTPResendInterval:  time.Minute,
+			OTPMaxPerDay:       10,
+		},
+		Password: Password{
+			Hasher:            "bcrypt",
+			BcryptCost:        12,
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+			MinLength:         8,
+			History:           5,
+		},
+		OIDC: OIDC{
+			RedirectURL: "http://localhost:8081/auth/oidc/callback",
+			Scopes:      "openid email profile",
+			RoleClaim:   "groups",
+			StateTTL:    10 * time.Minute,
+		},
+		Notify: Notify{
+			Sender:    "log",
+			OutboxDir: "outbox",
+			SMTPAddr:  "127.0.0.1:1025",
+			SMTPFrom:  "no-reply@localhost",
+			SMSSender: "log",
+		},
+		AbandonedCart: AbandonedCart{
+			Enabled:     true,
+			After:       24 * time.Hour,
+			Interval:    15 * time.Minute,
+			BatchSize:   100,
+			MaxAttempts: 3,
+			CartURL:     "http://localhost:3000/cart",
+		},
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// setting is one leaf field of Config.
+type setting struct {
+	key   string // file key and flag name, e.g. "jwt.access_ttl"
+	env   string
+	value reflect.Value
+}
+
+// Init loads the configuration with Load and makes it Current.
+func Init(args []string) error {
+	cfg, err := Load(args)
+	if err != nil {
+		return err
+	}
+	Current = cfg
+	return nil
+}
+
+// Load builds the configuration from the defaults, the file named by
+// -config or CONFIG_FILE, the environment and the flags in args, and
+// validates it. A nil args reads no flags.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Flags are parsed first to find -config, but applied last.
+	fs := flag.NewFlagSet("rice-api", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file (env CONFIG_FILE)")
+	var overrides []func() error
+	for _, s := range settings {
+		fs.Func(s.key, "env "+s.env, func(v string) error {
+			overrides = append(overrides, func() error {
+				if err := s.set(v); err != nil {
+					return fmt.Errorf("-%s: %w", s.key, err)
+				}
+				return nil
+			})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("config: unexpected argument %q", fs.Arg(0))
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, settings); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				return nil, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, apply := range overrides {
+		if err := apply(); err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+	}
+
+	cfg.Password.Hasher = strings.ToLower(cfg.Password.Hasher)
+	cfg.Notify.Sender = strings.ToLower(cfg.Notify.Sender)
+	cfg.Notify.SMSSender = strings.ToLower(cfg.Notify.SMSSender)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile applies a YAML (.yaml, .yml) or TOML (.toml) file. Unknown keys
+// are errors, so a typo does not silently keep the default.
+func loadFile(path string, settings []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	values := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).Decode(&values)
+	default:
+		return fmt.Errorf("config: %s: unsupported file type %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	flat := map[string]interface{}{}
+	flatten("", values, flat)
+
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, k := range keys {
+		s, ok := byKey[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", k))
+			continue
+		}
+		if err := s.set(fileValue(flat[k])); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %s: %w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+// flatten turns nested sections into dotted keys.
+func flatten(prefix string, values map[string]interface{}, out map[string]interface{}) {
+	for k, v := range values {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if section, ok := v.(map[string]interface{}); ok {
+			flatten(k, section, out)
+			continue
+		}
+		out[k] = v
+	}
+}
+
+// fileValue formats a decoded file value the way it would be written in
+// the environment.
+func fileValue(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// settings lists the leaf fields of cfg with their keys and environment
+// variables.
+func (cfg *Config) settings() []setting {
+	var out []setting
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := field.Tag.Get("key")
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(key, v.Field(i))
+				continue
+			}
+			out = append(out, setting{key: key, env: field.Tag.Get("env"), value: v.Field(i)})
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	return out
+}
+
+// envName returns the environment variable of a key, for error messages.
+func (cfg *Config) envName(key string) string {
+	for _, s := range cfg.settings() {
+		if s.key == key {
+			return s.env
+		}
+	}
+	return ""
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses v into the field.
+func (s setting) set(v string) error {
+	v = strings.TrimSpace(v)
+	f := s.value
+	switch {
+	case f.Type() == durationType:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(v)
+	case f.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		f.SetBool(b)
+	case f.Kind() == reflect.Int || f.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		f.SetInt(n)
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// bcrypt limits, repeated here so config does not depend on the hashing
+// package.
+const (
+	bcryptMinCost          = 4
+	bcryptMaxCost          = 31
+	bcryptMaxPasswordBytes = 72
+)
+
+// validator collects every problem so one start shows them all.
+type validator struct {
+	cfg  *Config
+	errs []error
+}
+
+// check records an error for key unless ok.
+func (v *validator) check(ok bool, key, format string, args ...interface{}) {
+	if ok {
+		return
+	}
+	name := key
+	if env := v.cfg.envName(key); env != "" {
+		name += " (" + env + ")"
+	}
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) url(key, value string, required bool) {
+	if value == "" {
+		v.check(!required, key, "is required")
+		return
+	}
+	u, err := url.Parse(value)
+	v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", key, "must be an http(s) URL, got %q", value)
+}
+
+// Validate reports every invalid setting at once.
+func (cfg *Config) Validate() error {
+	v := &validator{cfg: cfg}
+	dev := cfg.Env == "development"
+	v.check(cfg.Env != "", "env", "is required")
+
+	s := cfg.Server
+	_, _, err := net.SplitHostPort(s.Addr)
+	v.check(err == nil, "server.addr", "must be host:port or :port, got %q", s.Addr)
+	v.check(s.ReadTimeout > 0, "server.read_timeout", "must be positive")
+	v.check(s.ReadHeaderTimeout > 0, "server.read_header_timeout", "must be positive")
+	v.check(s.WriteTimeout > 0, "server.write_timeout", "must be positive")
+	v.check(s.IdleTimeout > 0, "server.idle_timeout", "must be positive")
+	v.check(s.MaxHeaderBytes >= 4<<10, "server.max_header_bytes", "must be at least 4096")
+	v.check(s.MaxBodyBytes > 0, "server.max_body_bytes", "must be positive")
+	v.check(s.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+
+	db := cfg.Database
+	v.check(db.User != "", "database.user", "is required")
+	v.check(db.Host != "", "database.host", "is required")
+	v.check(db.Port > 0 && db.Port <= 65535, "database.port", "must be between 1 and 65535")
+	v.check(db.Name != "", "database.name", "is required")
+
+	jwt := cfg.JWT
+	switch strings.ToUpper(jwt.Alg) {
+	case "HS256":
+		v.check(dev || jwt.Secret != DefaultJWTSecret, "jwt.secret", "must be set when env is %q", cfg.Env)
+		v.check(dev || len(jwt.Secret) >= 32, "jwt.secret", "must be at least 32 bytes")
+	case "RS256", "EDDSA":
+		v.check(jwt.SigningKeyFile != "", "jwt.signing_key_file", "is required for alg %s", jwt.Alg)
+	default:
+		v.check(false, "jwt.alg", "must be HS256, RS256 or EdDSA, got %q", jwt.Alg)
+	}
+	v.check(jwt.AccessTTL > 0, "jwt.access_ttl", "must be positive")
+	v.check(jwt.RefreshTTL > jwt.AccessTTL, "jwt.refresh_ttl", "must be longer than jwt.access_ttl")
+
+	up := cfg.Uploads
+	v.check(up.Dir != "", "uploads.dir", "is required")
+	v.check(up.MaxBytes > 0, "uploads.max_bytes", "must be positive")
+	v.check(up.MaxBytes < s.MaxBodyBytes, "uploads.max_bytes", "must be smaller than server.max_body_bytes")
+	v.check(len(up.AllowedTypes) > 0, "uploads.allowed_types", "needs at least one MIME type")
+
+	origins := cfg.CORS.AllowedOrigins
+	v.check(len(origins) > 0, "cors.allowed_origins", "needs at least one origin or *")
+	for _, origin := range origins {
+		if origin == "*" {
+			v.check(len(origins) == 1, "cors.allowed_origins", "* cannot be combined with other origins")
+			v.check(!cfg.CORS.AllowCredentials, "cors.allow_credentials", "cannot be true with cors.allowed_origins *, list the origins instead")
+			continue
+		}
+		u, err := url.Parse(origin)
+		v.check(err == nil && u.Scheme != "" && u.Host != "" && u.Path == "", "cors.allowed_origins", "%q is not an origin like https://shop.example.com", origin)
+	}
+
+	a := cfg.Auth
+	v.check(a.PasswordResetTTL > 0, "auth.password_reset_ttl", "must be positive")
+	v.url("auth.password_reset_url", a.PasswordResetURL, true)
+	v.check(a.InviteTTL > 0, "auth.invite_ttl", "must be positive")
+	v.url("auth.invite_url", a.InviteURL, true)
+	v.check(a.TOTPIssuer != "", "auth.totp_issuer", "is required")
+	v.check(a.TwoFactorTokenTTL > 0, "auth.two_factor_token_ttl", "must be positive")
+	v.check(a.ImpersonationTTL > 0, "auth.impersonation_ttl", "must be positive")
+
+	l := cfg.Lockout
+	v.check(l.MaxAttemptsPerAccount > 0, "lockout.max_attempts_account", "must be positive")
+	v.check(l.MaxAttemptsPerIP > 0, "lockout.max_attempts_ip", "must be positive")
+	v.check(l.AttemptWindow > 0, "lockout.attempt_window", "must be positive")
+	v.check(l.Base > 0, "lockout.base", "must be positive")
+	v.check(l.Max >= l.Base, "lockout.max", "must not be shorter than lockout.base")
+
+	e := cfg.EmailVerification
+	v.check(e.TTL > 0, "email_verification.ttl", "must be positive")
+	v.url("email_verification.url", e.URL, true)
+	v.check(e.ResendInterval > 0, "email_verification.resend_interval", "must be positive")
+	v.check(e.MaxPerDay > 0, "email_verification.max_per_day", "must be positive")
+
+	p := cfg.Phone
+	cc := p.DefaultCountryCode
+	v.check(len(cc) >= 1 && len(cc) <= 3 && strings.Trim(cc, "0123456789") == "", "phone.default_country_code", "must be 1 to 3 digits, got %q", cc)
+	v.check(p.OTPTTL > 0, "phone.otp_ttl", "must be positive")
+	v.check(p.OTPMaxAttempts > 0, "phone.otp_max_attempts", "must be positive")
+	v.check(p.OTPResendInterval > 0, "phone.otp_resend_interval", "must be positive")
+	v.check(p.OTPMaxPerDay > 0, "phone.otp_max_per_day", "must be positive")
+
+	pw := cfg.Password
+	switch pw.Hasher {
+	case "bcrypt":
+		v.check(pw.BcryptCost >= bcryptMinCost && pw.BcryptCost <= bcryptMaxCost, "password.bcrypt_cost", "must be between %d and %d", bcryptMinCost, bcryptMaxCost)
+	case "argon2id":
+		v.check(pw.Argon2Iterations > 0, "password.argon2_iterations", "must be positive")
+		v.check(pw.Argon2Parallelism > 0 && pw.Argon2Parallelism <= 255, "password.argon2_parallelism", "must be between 1 and 255")
+		v.check(pw.Argon2Memory >= 8*pw.Argon2Parallelism, "password.argon2_memory_kib", "must be at least 8 times password.argon2_parallelism")
+	default:
+		v.check(false, "password.hasher", "must be bcrypt or argon2id, got %q", pw.Hasher)
+	}
+	v.check(pw.MinLength > 0 && pw.MinLength <= bcryptMaxPasswordBytes, "password.min_length", "must be between 1 and %d", bcryptMaxPasswordBytes)
+	v.check(pw.History >= 0, "password.history", "must not be negative")
+
+	o := cfg.OIDC
+	if o.Issuer != "" {
+		v.url("oidc.issuer", o.Issuer, true)
+		v.check(o.ClientID != "", "oidc.client_id", "is required when oidc.issuer is set")
+		v.url("oidc.redirect_url", o.RedirectURL, true)
+		v.url("oidc.success_url", o.SuccessURL, false)
+		v.check(o.RoleMap != "" || o.DefaultRole != "", "oidc.role_map", "or oidc.default_role is required when oidc.issuer is set")
+		v.check(o.DefaultRole == "" || o.DefaultRole == "admin" || o.DefaultRole == "staff", "oidc.default_role", "must be admin or staff")
+		v.check(o.StateTTL > 0, "oidc.state_ttl", "must be positive")
+	}
+
+	n := cfg.Notify
+	switch n.Sender {
+	case "log":
+	case "file":
+		v.check(n.OutboxDir != "", "notify.outbox_dir", "is required for the file sender")
+	case "smtp":
+		_, _, err := net.SplitHostPort(n.SMTPAddr)
+		v.check(err == nil, "notify.smtp_addr", "must be host:port, got %q", n.SMTPAddr)
+		v.check(n.SMTPFrom != "", "notify.smtp_from", "is required for the smtp sender")
+	default:
+		v.check(false, "notify.sender", "must be log, file or smtp, got %q", n.Sender)
+	}
+	v.check(n.SMSSender == "log", "notify.sms_sender", "must be log, got %q", n.SMSSender)
+
+	c := cfg.AbandonedCart
+	if c.Enabled {
+		v.check(c.After > 0, "abandoned_cart.after", "must be positive")
+		v.check(c.Interval > 0, "abandoned_cart.interval", "must be positive")
+		v.check(c.BatchSize > 0, "abandoned_cart.batch_size", "must be positive")
+		v.check(c.MaxAttempts > 0, "abandoned_cart.max_attempts", "must be positive")
+		v.url("abandoned_cart.cart_url", c.CartURL, true)
+	}
+
+	if len(v.errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(v.errs...))
+	}
+	return nil
+}
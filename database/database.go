@@ -1,55 +1,71 @@
 package database
 
 import (
+	"fmt"
 	"log"
-	"os"
+	"net"
+	"strconv"
 
-	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/config"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// InitDB connects to the database and checks that its schema is at the
+// version of this binary. Pending migrations are applied when
+// database.migrate_on_start is set; otherwise startup stops and they have
+// to be applied with `migrate up`.
 func InitDB() {
-	// Connect DB
-	db, err := gorm.Open(mysql.Open(dsn()), &gorm.Config{})
+	db, err := Open()
 	if err != nil {
 		log.Fatal("cannot connect database: ", err)
 	}
-
 	DB = db
 
-	// Auto-migrate
-	if err := DB.AutoMigrate(
-		&models.Category{},
-		&models.Product{},
-		&models.User{},
-		&models.Customer{},
-		&models.Order{},
-		&models.OrderItem{},
-		&models.Cart{},
-		&models.CartItem{},
-	); err != nil {
+	pending, err := PendingMigrations(DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if !config.Current.Database.MigrateOnStart {
+		last := pending[len(pending)-1]
+		log.Fatalf("%v: %d, up to %d_%s; run `go run . migrate up` or set DB_MIGRATE_ON_START=true",
+			ErrPendingMigrations, len(pending), last.Version, last.Name)
+	}
+	applied, err := MigrateUp(DB, 0)
+	for _, mig := range applied {
+		log.Printf("migrated %d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func dsn() string {
-	// ปรับค่าตาม XAMPP ของคุณ
-	user := getenv("DB_USER", "root")
-	pass := getenv("DB_PASS", "")          // ค่าเริ่มต้น XAMPP ส่วนมากว่าง
-	host := getenv("DB_HOST", "127.0.0.1") // หลีกเลี่ยง "localhost" เพื่อไม่ให้ใช้ socket
-	port := getenv("DB_PORT", "3306")
-	name := getenv("DB_NAME", "go_api_db")
-
-	// parseTime=1 ให้ scan เป็น time.Time ได้, charset utf8mb4 รองรับ emoji/ພາສາລາວ
-	return user + ":" + pass + "@tcp(" + host + ":" + port + ")/" + name + "?parseTime=true&charset=utf8mb4&loc=Local"
+// Open connects to the database without touching the schema.
+func Open() (*gorm.DB, error) {
+	return gorm.Open(mysql.Open(dsn()), &gorm.Config{})
 }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// Close closes the connection pool. It is called once at shutdown, after
+// every request and job has finished.
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
 	}
-	return def
+	return sqlDB.Close()
+}
+
+func dsn() string {
+	cfg := config.Current.Database
+	// parseTime=1 ให้ scan เป็น time.Time ได้, charset utf8mb4 รองรับ emoji/ພາສາລາວ
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true&charset=utf8mb4&loc=Local",
+		cfg.User, cfg.Password, net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), cfg.Name)
 }
@@ -0,0 +1,383 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations are SQL files in migrations/, embedded in the binary:
+//
+//	0002_add_product_sku.up.sql    applied by MigrateUp
+//	0002_add_product_sku.down.sql  reverts it, used by MigrateDown
+//
+// Versions are applied in order and recorded in schema_migrations. MySQL
+// commits DDL implicitly, so a migration that fails halfway is not rolled
+// back: fix the database by hand, then run it again.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationTable records the applied versions.
+const migrationTable = "schema_migrations"
+
+// migrationLock is the MySQL named lock that keeps two processes from
+// migrating at the same time.
+const migrationLock = "rice-api-migrate"
+
+var (
+	migrationFileName  = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	migrationNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ErrPendingMigrations is returned by InitDB when the database is behind
+// the binary and migrations are not applied at startup.
+var ErrPendingMigrations = errors.New("database has pending migrations")
+
+// Migration is one embedded schema change.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and whether it is applied. Migrations that
+// were applied by a newer binary have no Up or Down.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// appliedMigration is a row of schema_migrations.
+type appliedMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return migrationTable
+}
+
+// LoadMigrations returns the embedded migrations ordered by version.
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		m := migrationFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", entry.Name())
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[uint(version)]
+		if mig == nil {
+			mig = &Migration{Version: uint(version), Name: m[2]}
+			byVersion[uint(version)] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d: two names, %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if len(splitStatements(mig.Up)) == 0 {
+			return nil, fmt.Errorf("migration %d_%s: .up.sql is missing or has no statements", mig.Version, mig.Name)
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing .down.sql", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatus lists every embedded migration and every version recorded
+// in the database, ordered by version.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := createMigrationTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(migrations, applied), nil
+}
+
+// PendingMigrations returns the embedded migrations not yet applied.
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies the pending migrations up to and including version to,
+// or all of them when to is 0, and returns the ones it applied.
+func MigrateUp(db *gorm.DB, to uint) ([]Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if to != 0 && mig.Version > to {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := execMigration(conn, mig, mig.Up); err != nil {
+				return err
+			}
+			row := appliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}
+			if err := conn.Create(&row).Error; err != nil {
+				return fmt.Errorf("migration %d_%s applied but not recorded: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns the ones it reverted.
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]Migration, len(migrations))
+	for _, mig := range migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	var done []Migration
+	err = withMigrationLock(db, func(conn *gorm.DB) error {
+		var rows []appliedMigration
+		if err := conn.Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			mig, ok := byVersion[row.Version]
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but not part of this build, roll back with the binary that applied it", row.Version, row.Name)
+			}
+			if err := execMigration(conn, mig, mig.Down); err != nil {
+				return err
+			}
+			if err := conn.Delete(&appliedMigration{}, row.Version).Error; err != nil {
+				return fmt.Errorf("migration %d_%s reverted but still recorded: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// CreateMigration writes an empty up/down pair to dir with the next
+// version and returns the paths. The binary must be rebuilt to embed them.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = migrationNameChars.ReplaceAllString(name, "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var last uint64
+	for _, entry := range entries {
+		if m := migrationFileName.FindStringSubmatch(entry.Name()); m != nil {
+			if v, _ := strconv.ParseUint(m[1], 10, 32); v > last {
+				last = v
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%04d_%s", last+1, name)
+	files := []struct{ path, body string }{
+		{filepath.Join(dir, base+".up.sql"), "-- " + base + ": describe the change.\n"},
+		{filepath.Join(dir, base+".down.sql"), "-- Reverts " + base + ".\n"},
+	}
+	var paths []string
+	for _, f := range files {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return paths, err
+		}
+		_, err = file.WriteString(f.body)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, f.path)
+	}
+	return paths, nil
+}
+
+// withMigrationLock runs fn on one connection holding the migration lock.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	if err := createMigrationTable(db); err != nil {
+		return err
+	}
+	return db.Connection(func(conn *gorm.DB) error {
+		var got sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLock, 60).Row().Scan(&got); err != nil {
+			return err
+		}
+		if got.Int64 != 1 {
+			return errors.New("another process is migrating the database")
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", migrationLock)
+		return fn(conn)
+	})
+}
+
+func createMigrationTable(db *gorm.DB) error {
+	return db.Exec("CREATE TABLE IF NOT EXISTS `" + migrationTable + "` (" +
+		"`version` bigint unsigned NOT NULL, " +
+		"`name` varchar(255) NOT NULL, " +
+		"`applied_at` datetime(3) NOT NULL, " +
+		"PRIMARY KEY (`version`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4").Error
+}
+
+func appliedMigrations(db *gorm.DB) (map[uint]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func migrationStates(migrations []Migration, applied map[uint]appliedMigration) []MigrationState {
+	states := make([]MigrationState, 0, len(migrations))
+	known := map[uint]bool{}
+	for _, mig := range migrations {
+		state := MigrationState{Migration: mig}
+		if row, ok := applied[mig.Version]; ok {
+			at := row.AppliedAt
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+		known[mig.Version] = true
+	}
+	for version, row := range applied {
+		if !known[version] {
+			at := row.AppliedAt
+			states = append(states, MigrationState{Migration: Migration{Version: version, Name: row.Name}, AppliedAt: &at})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states
+}
+
+// execMigration runs the statements of one direction of mig in order.
+func execMigration(db *gorm.DB, mig Migration, script string) error {
+	for i, stmt := range splitStatements(script) {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("migration %d_%s, statement %d: %w", mig.Version, mig.Name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on semicolons outside quotes and
+// comments, because the MySQL driver runs one statement per call. Comment
+// lines and empty statements are dropped.
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	var quote byte
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case quote != 0:
+			cur.WriteByte(ch)
+			if ch == '\\' && quote != '`' && i+1 < len(script) {
+				i++
+				cur.WriteByte(script[i])
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			cur.WriteByte(ch)
+		case ch == '#' || (ch == '-' && strings.HasPrefix(script[i:], "-- ")):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			cur.WriteByte('\n')
+		case ch == ';':
+			flush()
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	flush()
+	return stmts
+}
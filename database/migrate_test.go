@@ -0,0 +1,47 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"only comments", "-- nothing\n# here\n", nil},
+		{"one statement without semicolon", "SELECT 1", []string{"SELECT 1"}},
+		{"two statements", "SELECT 1;\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements dropped", ";;SELECT 1;;", []string{"SELECT 1"}},
+		{"semicolon in single quotes", "INSERT INTO t VALUES ('a;b');", []string{"INSERT INTO t VALUES ('a;b')"}},
+		{"semicolon in double quotes", `SELECT "a;b";`, []string{`SELECT "a;b"`}},
+		{"semicolon in backticks", "SELECT 1 AS `a;b`;", []string{"SELECT 1 AS `a;b`"}},
+		{"escaped quote", `SELECT 'it\'s; fine';`, []string{`SELECT 'it\'s; fine'`}},
+		{"doubled quote", "SELECT 'it''s; fine';", []string{"SELECT 'it''s; fine'"}},
+		{
+			"dash comment with semicolon",
+			"-- drop the index; then the column\nALTER TABLE t DROP COLUMN c;",
+			[]string{"ALTER TABLE t DROP COLUMN c"},
+		},
+		{"hash comment with semicolon", "SELECT 1; # trailing; comment\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"double dash without space is not a comment", "SELECT 1--2;", []string{"SELECT 1--2"}},
+		{"comment marker in quotes", "SELECT '-- not a comment; really';", []string{"SELECT '-- not a comment; really'"}},
+		{
+			"multi-line statement",
+			"CREATE TABLE t (\n  id INT, -- key\n  name VARCHAR(10)\n);",
+			[]string{"CREATE TABLE t (\n  id INT, \n  name VARCHAR(10)\n)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
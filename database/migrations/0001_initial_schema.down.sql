@@ -0,0 +1,26 @@
+-- Drops every table of the initial schema, children before parents.
+DROP TABLE IF EXISTS `impersonated_requests`;
+DROP TABLE IF EXISTS `audit_logs`;
+DROP TABLE IF EXISTS `phone_otps`;
+DROP TABLE IF EXISTS `o_id_c_login_states`;
+DROP TABLE IF EXISTS `password_histories`;
+DROP TABLE IF EXISTS `user_invites`;
+DROP TABLE IF EXISTS `security_policies`;
+DROP TABLE IF EXISTS `recovery_codes`;
+DROP TABLE IF EXISTS `api_keys`;
+DROP TABLE IF EXISTS `login_throttles`;
+DROP TABLE IF EXISTS `action_tokens`;
+DROP TABLE IF EXISTS `subject_revocations`;
+DROP TABLE IF EXISTS `revoked_tokens`;
+DROP TABLE IF EXISTS `sessions`;
+DROP TABLE IF EXISTS `refresh_tokens`;
+DROP TABLE IF EXISTS `saved_items`;
+DROP TABLE IF EXISTS `cart_reminders`;
+DROP TABLE IF EXISTS `cart_items`;
+DROP TABLE IF EXISTS `carts`;
+DROP TABLE IF EXISTS `order_items`;
+DROP TABLE IF EXISTS `orders`;
+DROP TABLE IF EXISTS `customers`;
+DROP TABLE IF EXISTS `users`;
+DROP TABLE IF EXISTS `products`;
+DROP TABLE IF EXISTS `categories`;
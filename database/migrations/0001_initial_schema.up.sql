@@ -0,0 +1,339 @@
+-- Initial schema: the tables GORM AutoMigrate created before versioned
+-- migrations. IF NOT EXISTS lets databases created by AutoMigrate adopt
+-- this migration without changes.
+
+CREATE TABLE IF NOT EXISTS `categories` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `name` varchar(191) NOT NULL,
+  `description` longtext,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `uni_categories_name` UNIQUE (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `products` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `name` longtext,
+  `price` bigint,
+  `image` longtext,
+  `category_id` bigint unsigned,
+  `stock` bigint,
+  `version` bigint unsigned NOT NULL DEFAULT 1,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_products_category` FOREIGN KEY (`category_id`) REFERENCES `categories`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `username` varchar(191) NOT NULL,
+  `email` varchar(191) NOT NULL,
+  `password` longtext NOT NULL,
+  `role` varchar(20) NOT NULL DEFAULT 'admin',
+  `created_at` datetime(3) NULL,
+  `totp_secret` varchar(64),
+  `totp_pending_secret` varchar(64),
+  `totp_last_step` bigint,
+  `totp_enabled_at` datetime(3) NULL,
+  `o_id_c_issuer` varchar(255),
+  `o_id_c_subject` varchar(255),
+  `disabled_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_users_oidc` (`o_id_c_issuer`,`o_id_c_subject`),
+  CONSTRAINT `uni_users_username` UNIQUE (`username`),
+  CONSTRAINT `uni_users_email` UNIQUE (`email`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `customers` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `name` longtext NOT NULL,
+  `email` varchar(191),
+  `password` longtext NOT NULL,
+  `phone` longtext,
+  `login_phone` varchar(20),
+  `address` longtext,
+  `email_verified_at` datetime(3) NULL,
+  `erased_at` datetime(3) NULL,
+  `version` bigint unsigned NOT NULL DEFAULT 1,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `uni_customers_email` UNIQUE (`email`),
+  CONSTRAINT `uni_customers_login_phone` UNIQUE (`login_phone`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `orders` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `customer_id` bigint unsigned NOT NULL,
+  `status` varchar(191) DEFAULT 'pending',
+  `total_amount` bigint,
+  `shipping_address` longtext,
+  `version` bigint unsigned NOT NULL DEFAULT 1,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_customers_orders` FOREIGN KEY (`customer_id`) REFERENCES `customers`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `order_items` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `order_id` bigint unsigned NOT NULL,
+  `product_id` bigint unsigned NOT NULL,
+  `product_image` longtext,
+  `quantity` bigint NOT NULL,
+  `price` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_order_items_product` FOREIGN KEY (`product_id`) REFERENCES `products`(`id`),
+  CONSTRAINT `fk_orders_order_items` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `carts` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `customer_id` bigint unsigned,
+  `total_amount` bigint,
+  `version` bigint unsigned NOT NULL DEFAULT 1,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_carts_customer_id` (`customer_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `cart_items` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `cart_id` bigint unsigned,
+  `product_id` bigint unsigned NOT NULL,
+  `product_name` longtext,
+  `product_image` longtext,
+  `unit_price` bigint,
+  `quantity` bigint,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_cart_items_cart_id` (`cart_id`),
+  CONSTRAINT `fk_carts_items` FOREIGN KEY (`cart_id`) REFERENCES `carts`(`id`),
+  CONSTRAINT `fk_cart_items_product` FOREIGN KEY (`product_id`) REFERENCES `products`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `cart_reminders` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `cart_id` bigint unsigned,
+  `customer_id` bigint unsigned,
+  `cart_updated_at` datetime(3) NULL,
+  `cart_total` bigint,
+  `status` varchar(191) DEFAULT 'queued',
+  `attempts` bigint,
+  `last_error` longtext,
+  `sent_at` datetime(3) NULL,
+  `converted_at` datetime(3) NULL,
+  `order_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_cart_reminders_cart_id` (`cart_id`),
+  INDEX `idx_cart_reminders_customer_id` (`customer_id`),
+  INDEX `idx_cart_reminders_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `saved_items` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `customer_id` bigint unsigned,
+  `product_id` bigint unsigned,
+  `saved_price` bigint,
+  `quantity` bigint,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_saved_items_customer_product` (`customer_id`,`product_id`),
+  CONSTRAINT `fk_saved_items_product` FOREIGN KEY (`product_id`) REFERENCES `products`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `token_hash` varchar(64) NOT NULL,
+  `family_id` varchar(64),
+  `subject_type` varchar(20),
+  `subject_id` bigint unsigned,
+  `expires_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  `replaced_by_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_refresh_tokens_token_hash` (`token_hash`),
+  INDEX `idx_refresh_tokens_family_id` (`family_id`),
+  INDEX `idx_refresh_tokens_subject` (`subject_type`,`subject_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `family_id` varchar(64) NOT NULL,
+  `subject_type` varchar(20),
+  `subject_id` bigint unsigned,
+  `device` longtext,
+  `ip` varchar(45),
+  `user_agent` varchar(512),
+  `created_at` datetime(3) NULL,
+  `last_seen_at` datetime(3) NULL,
+  `expires_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_sessions_family_id` (`family_id`),
+  INDEX `idx_sessions_subject` (`subject_type`,`subject_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `jti` varchar(64),
+  `expires_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`jti`),
+  INDEX `idx_revoked_tokens_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `subject_revocations` (
+  `subject_type` varchar(20),
+  `subject_id` bigint unsigned,
+  `revoked_at` datetime(3) NOT NULL,
+  PRIMARY KEY (`subject_type`,`subject_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `action_tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `purpose` varchar(32),
+  `subject_type` varchar(20),
+  `subject_id` bigint unsigned,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_action_tokens_subject` (`purpose`,`subject_type`,`subject_id`),
+  UNIQUE INDEX `idx_action_tokens_token_hash` (`token_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `login_throttles` (
+  `key` varchar(191),
+  `failures` bigint,
+  `last_failure_at` datetime(3) NULL,
+  `locked_until` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `name` longtext NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `key_hash` varchar(64) NOT NULL,
+  `scopes` longtext,
+  `expires_at` datetime(3) NULL,
+  `last_used_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  `created_by_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_api_keys_prefix` (`prefix`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_recovery_codes_user_id` (`user_id`),
+  UNIQUE INDEX `idx_recovery_codes_code_hash` (`code_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `security_policies` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `require_staff2_fa` boolean NOT NULL DEFAULT false,
+  `updated_by_id` bigint unsigned,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `user_invites` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `email` longtext,
+  `role` varchar(20) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  `used_by_id` bigint unsigned,
+  `revoked_at` datetime(3) NULL,
+  `created_by_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_user_invites_token_hash` (`token_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `password_histories` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `subject_type` varchar(20),
+  `subject_id` bigint unsigned,
+  `password_hash` longtext NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_password_histories_subject` (`subject_type`,`subject_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `o_id_c_login_states` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `state_hash` varchar(64) NOT NULL,
+  `nonce` varchar(64) NOT NULL,
+  `code_verifier` varchar(128) NOT NULL,
+  `expires_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_o_id_c_login_states_state_hash` (`state_hash`),
+  INDEX `idx_o_id_c_login_states_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `phone_otps` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `phone` varchar(20) NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `attempts` bigint NOT NULL DEFAULT 0,
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_phone_otps_phone` (`phone`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `actor_type` varchar(20),
+  `actor_id` bigint unsigned,
+  `actor_name` longtext,
+  `role` varchar(20),
+  `ip` varchar(45),
+  `action` varchar(20),
+  `entity_type` varchar(30),
+  `entity_id` bigint unsigned,
+  `before` text,
+  `after` text,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_audit_actor` (`actor_type`,`actor_id`),
+  INDEX `idx_audit_logs_action` (`action`),
+  INDEX `idx_audit_entity` (`entity_type`,`entity_id`),
+  INDEX `idx_audit_logs_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `impersonated_requests` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `token_id` varchar(32),
+  `actor_id` bigint unsigned,
+  `actor_name` longtext,
+  `actor_role` varchar(20),
+  `customer_id` bigint unsigned,
+  `method` varchar(10),
+  `path` longtext,
+  `status` bigint,
+  `ip` varchar(45),
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_impersonated_requests_token_id` (`token_id`),
+  INDEX `idx_impersonated_requests_actor_id` (`actor_id`),
+  INDEX `idx_impersonated_requests_customer_id` (`customer_id`),
+  INDEX `idx_impersonated_requests_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+-- Reverts 0002_soft_delete_products. Deleted products become visible again.
+ALTER TABLE `products`
+  DROP INDEX `idx_products_deleted_at`,
+  DROP COLUMN `deleted_at`;
@@ -0,0 +1,5 @@
+-- Products are soft-deleted: cart_items, saved_items and order_items keep
+-- foreign keys to them, so a hard delete fails once a product was used.
+ALTER TABLE `products`
+  ADD COLUMN `deleted_at` datetime(3) NULL,
+  ADD INDEX `idx_products_deleted_at` (`deleted_at`);
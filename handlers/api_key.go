@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ເບິ່ງ API keys ທັງໝົດ (admin only)
+func GetAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := database.DB.Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"keys":             keys,
+		"available_scopes": auth.APIKeyScopes,
+	})
+}
+
+// ສ້າງ API key ໃໝ່ (admin only). The plain key is returned only once.
+func CreateAPIKey(c *gin.Context) {
+	if c.GetString("auth_method") == "api_key" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create API keys"})
+		return
+	}
+
+	var input models.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	key, plain, err := auth.CreateAPIKey(input.Name, input.Scopes, input.ExpiresAt, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(c, audit.ActionCreate, audit.EntityAPIKey, key.ID, nil, audit.Snapshot(key))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "ເກັບ key ນີ້ໄວ້ໃຫ້ດີ, ຈະບໍ່ສະແດງອີກ",
+		"api_key": key,
+		"key":     plain,
+	})
+}
+
+// ຍົກເລີກ API key (admin only)
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key id"})
+		return
+	}
+
+	revoked, err := auth.RevokeAPIKey(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	audit.Record(c, audit.ActionRevoke, audit.EntityAPIKey, uint(id), nil, nil)
+	c.Status(http.StatusNoContent)
+}
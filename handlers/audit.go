@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// ເບິ່ງ audit log (admin only). Filters: actor_type, actor_id, role,
+// action, entity_type, entity_id, from, to (RFC 3339); page and page_size.
+func GetAuditLogs(c *gin.Context) {
+	query := database.DB.Model(&models.AuditLog{})
+
+	for _, field := range []string{"actor_type", "role", "action", "entity_type"} {
+		if v := c.Query(field); v != "" {
+			query = query.Where(field+" = ?", v)
+		}
+	}
+	for _, field := range []string{"actor_id", "entity_id"} {
+		if v := c.Query(field); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": field + " must be a number"})
+				return
+			}
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	for field, op := range map[string]string{"from": ">=", "to": "<"} {
+		if v := c.Query(field); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": field + " must be an RFC 3339 time"})
+				return
+			}
+			query = query.Where("created_at "+op+" ?", t)
+		}
+	}
+
+	page, pageSize, ok := parsePagination(c, defaultAuditPageSize, maxAuditPageSize)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []models.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":     entries,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// parsePagination reads page (from 1) and page_size from the query string.
+func parsePagination(c *gin.Context, defaultSize, maxSize int) (int, int, bool) {
+	page, pageSize := 1, defaultSize
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+			return 0, 0, false
+		}
+		page = n
+	}
+	if v := c.Query("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and " + strconv.Itoa(maxSize)})
+			return 0, 0, false
+		}
+		pageSize = n
+	}
+	return page, pageSize, true
+}
@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
 	"example.com/go-xampp-api/database"
 	"example.com/go-xampp-api/models"
 	"example.com/go-xampp-api/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// ການລົງທະບຽນ
+// ການລົງທະບຽນ (ຕ້ອງມີ invite ຈາກ admin)
 func Register(c *gin.Context) {
 	var input models.RegisterInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -17,34 +22,82 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// ກວດສອບວ່າມີ username ຫຼື email ຊ້ຳບໍ່
-	var existingUser models.User
-	if err := database.DB.Where("username = ? OR email = ?", input.Username, input.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "username ຫຼື email ຖືກໃຊ້ແລ້ວ"})
+	// ກວດສອບ password policy ແລ້ວ hash
+	hashedPassword, ok := hashNewPassword(c, auth.SubjectUser, 0, "", input.Password)
+	if !ok {
 		return
 	}
 
-	// Hash password
-	hashedPassword, err := utils.HashPassword(input.Password)
+	tx := database.DB.Begin()
+
+	invite, err := auth.FindInvite(tx, input.InviteToken, input.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດ hash password ໄດ້"})
+		tx.Rollback()
+		if errors.Is(err, auth.ErrInvalidInvite) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// ກວດສອບວ່າມີ username ຫຼື email ຊ້ຳບໍ່
+	var existingUser models.User
+	if err := tx.Where("username = ? OR email = ?", input.Username, input.Email).First(&existingUser).Error; err == nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "username ຫຼື email ຖືກໃຊ້ແລ້ວ"})
 		return
 	}
 
-	// ສ້າງຜູ້ໃຊ້ໃໝ່
+	// ສ້າງຜູ້ໃຊ້ໃໝ່ດ້ວຍ role ຈາກ invite
 	user := models.User{
 		Username: input.Username,
 		Email:    input.Email,
 		Password: hashedPassword,
+		Role:     invite.Role,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := tx.Create(&user).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := auth.ConsumeInvite(tx, invite.ID, user.ID); err != nil {
+		tx.Rollback()
+		if errors.Is(err, auth.ErrInvalidInvite) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ເມື່ອ policy ບັງຄັບ 2FA, ຜູ້ໃຊ້ໃໝ່ໄດ້ພຽງ enrollment token
+	step, err := secondFactorStep(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if step != nil {
+		step["message"] = "ລົງທະບຽນສຳເລັດ, ຕ້ອງຕັ້ງຄ່າ 2FA ກ່ອນເຂົ້າສູ່ລະບົບ"
+		step["user"] = gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"role":     user.Role,
+		}
+		c.JSON(http.StatusCreated, step)
+		return
+	}
+
 	// ສ້າງ token
-	token, err := utils.GenerateToken(user.ID, user.Username, "admin")
+	tokens, err := auth.IssueTokens(clientInfo(c), user.ID, user.Username, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
 		return
@@ -56,8 +109,11 @@ func Register(c *gin.Context) {
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
+			"role":     user.Role,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -69,33 +125,254 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// ກວດສອບວ່າຖືກລັອກຍ້ອນເດົາ password ຜິດຫຼາຍຄັ້ງບໍ່
+	accountKey := auth.AccountThrottleKey(auth.SubjectUser, input.Username)
+	if !checkLoginThrottle(c, accountKey) {
+		return
+	}
+
 	// ຊອກຫາຜູ້ໃຊ້
 	var user models.User
 	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
+		utils.SimulatePasswordCheck(input.Password)
+		recordLoginFailure(c, accountKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "username ຫຼື password ບໍ່ຖືກຕ້ອງ"})
 		return
 	}
 
 	// ກວດສອບ password
 	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		recordLoginFailure(c, accountKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "username ຫຼື password ບໍ່ຖືກຕ້ອງ"})
 		return
 	}
+	upgradePasswordHash(auth.SubjectUser, user.ID, input.Password, user.Password)
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "ບັນຊີນີ້ຖືກປິດການໃຊ້ງານແລ້ວ"})
+		return
+	}
 
-	// ສ້າງ token
-	token, err := utils.GenerateToken(user.ID, user.Username, "admin")
+	// ບັນຊີທີ່ເປີດ 2FA ນັບວ່າສຳເລັດເມື່ອກວດລະຫັດ TOTP ແລ້ວ
+	if user.TOTPEnabledAt == nil {
+		recordLoginSuccess(accountKey)
+	}
+
+	step, err := secondFactorStep(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if step != nil {
+		c.JSON(http.StatusOK, step)
+		return
+	}
+
+	respondUserLogin(c, user, http.StatusOK)
+}
+
+// secondFactorStep returns the response for a staff user who still needs a
+// second factor after the first one (password or identity provider), or nil
+// when tokens may be issued:
+//   - users with 2FA get a challenge token for POST /login/2fa
+//   - while the security policy requires 2FA, users without it get an
+//     enrollment token that only works on /auth/2fa
+func secondFactorStep(user models.User) (gin.H, error) {
+	// ບັນຊີທີ່ເປີດ 2FA ຕ້ອງສົ່ງລະຫັດ TOTP ທີ່ POST /login/2fa ກ່ອນ
+	if user.TOTPEnabledAt != nil {
+		challenge, err := auth.CreateActionToken(database.DB, models.ActionLogin2FA, auth.SubjectUser, user.ID, config.Current.Auth.TwoFactorTokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"message":             "ກະລຸນາໃສ່ລະຫັດຢືນຢັນ 2FA",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(config.Current.Auth.TwoFactorTokenTTL.Seconds()),
+		}, nil
+	}
+
+	// ເມື່ອ policy ບັງຄັບ 2FA, ຜູ້ໃຊ້ທີ່ຍັງບໍ່ໄດ້ຕັ້ງຄ່າຈະໄດ້ token ສຳລັບຕັ້ງຄ່າ 2FA ເທົ່ານັ້ນ
+	policy, err := auth.GetSecurityPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if policy.RequireStaff2FA {
+		enrollment, err := auth.IssueTOTPEnrollmentToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"message":                   "ຕ້ອງຕັ້ງຄ່າ 2FA ກ່ອນເຂົ້າສູ່ລະບົບ",
+			"two_factor_setup_required": true,
+			"enrollment_token":          enrollment.Token,
+			"expires_in":                int64(config.Current.Auth.TwoFactorTokenTTL.Seconds()),
+		}, nil
+	}
+	return nil, nil
+}
+
+// respondUserLogin issues tokens for a staff user who passed every login
+// step. Disabled users are refused.
+func respondUserLogin(c *gin.Context, user models.User, status int) {
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "ບັນຊີນີ້ຖືກປິດການໃຊ້ງານແລ້ວ"})
+		return
+	}
+	tokens, err := auth.IssueTokens(clientInfo(c), user.ID, user.Username, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(status, gin.H{
 		"message": "ເຂົ້າສູ່ລະບົບສຳເລັດ",
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
+			"role":     user.Role,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// ຂໍ access token ໃໝ່ດ້ວຍ refresh token (refresh token ຈະຖືກປ່ຽນໃໝ່ທຸກຄັ້ງ)
+func RefreshToken(c *gin.Context) {
+	var input models.RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := auth.Refresh(clientInfo(c), input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrTwoFactorRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
+
+// ອອກຈາກລະບົບ: ຍົກເລີກ access token ປັດຈຸບັນ ແລະ refresh token (ຖ້າສົ່ງມາ).
+// "all": true ຍົກເລີກທຸກ token ຂອງບັນຊີນີ້ໃນທຸກອຸປະກອນ.
+func Logout(c *gin.Context) {
+	var input models.LogoutInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// staff ທີ່ໃຊ້ແທນ customer ອອກຈາກລະບົບໄດ້ສະເພາະ token ຂອງຕົນເອງ
+	if input.All && c.GetUint("impersonator_id") != 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "all is not allowed while impersonating"})
+		return
+	}
+
+	jti := c.GetString("token_id")
+	expiresAt := c.GetTime("token_expires_at")
+	if err := auth.RevokeAccessToken(jti, expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ຈົບ session ຂອງ token ນີ້ (refresh token ຂອງ session ນີ້ໃຊ້ບໍ່ໄດ້ອີກ)
+	if sessionID := c.GetUint("session_id"); sessionID != 0 {
+		subjectType := auth.SubjectTypeForRole(c.GetString("role"))
+		if _, err := auth.RevokeSession(sessionID, subjectType, c.GetUint("user_id")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if input.RefreshToken != "" {
+		if err := auth.RevokeRefreshToken(input.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if input.All {
+		subjectID := c.GetUint("user_id")
+		subjectType := auth.SubjectTypeForRole(c.GetString("role"))
+		if err := auth.RevokeSubject(database.DB, subjectType, subjectID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ອອກຈາກລະບົບສຳເລັດ"})
+}
+
+// checkLoginThrottle answers 429 with a generic message and returns false
+// when the account or the client IP is temporarily locked.
+func checkLoginThrottle(c *gin.Context, accountKey string) bool {
+	retryAfter, err := auth.LoginRetryAfter(accountKey, auth.IPThrottleKey(c.ClientIP()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "ເຂົ້າສູ່ລະບົບຜິດຫຼາຍເກີນໄປ, ກະລຸນາລອງໃໝ່ພາຍຫຼັງ"})
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed login for the account and the client
+// IP. Errors are only logged so the response stays the same.
+func recordLoginFailure(c *gin.Context, accountKey string) {
+	if err := auth.RecordLoginFailure(accountKey, config.Current.Lockout.MaxAttemptsPerAccount); err != nil {
+		log.Printf("record login failure for %s: %v", accountKey, err)
+	}
+	ipKey := auth.IPThrottleKey(c.ClientIP())
+	if err := auth.RecordLoginFailure(ipKey, config.Current.Lockout.MaxAttemptsPerIP); err != nil {
+		log.Printf("record login failure for %s: %v", ipKey, err)
+	}
+}
+
+func recordLoginSuccess(accountKey string) {
+	if err := auth.RecordLoginSuccess(accountKey); err != nil {
+		log.Printf("reset login failures for %s: %v", accountKey, err)
+	}
+}
+
+// hashNewPassword applies the password policy and hashes an accepted
+// password. New accounts pass subjectID 0 and an empty currentHash. On
+// failure the response has been written and ok is false.
+func hashNewPassword(c *gin.Context, subjectType string, subjectID uint, currentHash, password string) (string, bool) {
+	if err := auth.CheckNewPassword(subjectType, subjectID, currentHash, password); err != nil {
+		if errors.Is(err, utils.ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return "", false
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດ hash password ໄດ້"})
+		return "", false
+	}
+	return hashedPassword, true
+}
+
+// upgradePasswordHash rehashes a just verified password when the hasher
+// settings changed. Errors are only logged so the login still succeeds.
+func upgradePasswordHash(subjectType string, subjectID uint, password, hash string) {
+	if err := auth.UpgradePasswordHash(subjectType, subjectID, password, hash); err != nil {
+		log.Printf("upgrade password hash of %s %d: %v", subjectType, subjectID, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"example.com/go-xampp-api/models"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GetCart returns the authenticated customer's cart.
@@ -25,6 +26,7 @@ func GetCart(c *gin.Context) {
 	}
 
 	hydrateCart(&cart)
+	setETag(c, cart.Version)
 	c.JSON(http.StatusOK, cart)
 }
 
@@ -54,6 +56,10 @@ func AddCartItem(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
 
 	var product models.Product
 	if err := tx.First(&product, input.ProductID).Error; err != nil {
@@ -118,6 +124,7 @@ func AddCartItem(c *gin.Context) {
 	}
 
 	hydrateCart(&cart)
+	setETag(c, cart.Version)
 	c.JSON(http.StatusOK, cart)
 }
 
@@ -148,6 +155,10 @@ func UpdateCartItem(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
 
 	var item models.CartItem
 	if err := tx.Where("id = ? AND cart_id = ?", itemID, cart.ID).First(&item).Error; err != nil {
@@ -185,6 +196,7 @@ func UpdateCartItem(c *gin.Context) {
 	}
 
 	hydrateCart(&cart)
+	setETag(c, cart.Version)
 	c.JSON(http.StatusOK, cart)
 }
 
@@ -209,6 +221,10 @@ func DeleteCartItem(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
 
 	result := tx.Where("id = ? AND cart_id = ?", itemID, cart.ID).Delete(&models.CartItem{})
 	if result.Error != nil {
@@ -240,6 +256,7 @@ func DeleteCartItem(c *gin.Context) {
 	}
 
 	hydrateCart(&cart)
+	setETag(c, cart.Version)
 	c.JSON(http.StatusOK, cart)
 }
 
@@ -258,6 +275,10 @@ func ClearCart(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
 
 	if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
 		tx.Rollback()
@@ -283,9 +304,127 @@ func ClearCart(c *gin.Context) {
 	}
 
 	hydrateCart(&cart)
+	setETag(c, cart.Version)
 	c.JSON(http.StatusOK, cart)
 }
 
+// cartRefreshChange describes one adjustment made by RefreshCart.
+type cartRefreshChange struct {
+	ItemID      uint   `json:"item_id"`
+	ProductID   uint   `json:"product_id"`
+	Change      string `json:"change"` // price_updated, quantity_reduced, removed
+	OldPrice    int    `json:"old_price,omitempty"`
+	NewPrice    int    `json:"new_price,omitempty"`
+	OldQuantity int    `json:"old_quantity,omitempty"`
+	NewQuantity int    `json:"new_quantity,omitempty"`
+}
+
+// RefreshCart accepts the current product prices for every cart item,
+// removes items whose product no longer exists or is out of stock and
+// reduces quantities to the available stock.
+func RefreshCart(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	cart, err := findOrCreateCart(tx, customerID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
+
+	var items []models.CartItem
+	if err := tx.Preload("Product").Where("cart_id = ?", cart.ID).Find(&items).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes := []cartRefreshChange{}
+	for i := range items {
+		item := &items[i]
+		product := item.Product
+		if product == nil || (product.Stock != nil && *product.Stock <= 0) {
+			if err := tx.Delete(&models.CartItem{}, item.ID).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			changes = append(changes, cartRefreshChange{
+				ItemID:      item.ID,
+				ProductID:   item.ProductID,
+				Change:      "removed",
+				OldQuantity: item.Quantity,
+			})
+			continue
+		}
+
+		updates := map[string]interface{}{}
+		if product.Price != item.UnitPrice {
+			updates["unit_price"] = product.Price
+			changes = append(changes, cartRefreshChange{
+				ItemID:    item.ID,
+				ProductID: item.ProductID,
+				Change:    "price_updated",
+				OldPrice:  item.UnitPrice,
+				NewPrice:  product.Price,
+			})
+		}
+		if product.Stock != nil && *product.Stock < item.Quantity {
+			updates["quantity"] = *product.Stock
+			changes = append(changes, cartRefreshChange{
+				ItemID:      item.ID,
+				ProductID:   item.ProductID,
+				Change:      "quantity_reduced",
+				OldQuantity: item.Quantity,
+				NewQuantity: *product.Stock,
+			})
+		}
+		if product.Name != item.ProductName {
+			updates["product_name"] = product.Name
+		}
+		updates["product_image"] = product.Image
+
+		if err := tx.Model(&models.CartItem{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := recalcCartTotals(tx, cart.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err = loadCartByID(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hydrateCart(&cart)
+	setETag(c, cart.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"cart":    cart,
+		"changes": changes,
+	})
+}
+
 func getCustomerID(c *gin.Context) (uint, bool) {
 	role, ok := c.Get("role")
 	if !ok || role != "customer" {
@@ -323,9 +462,11 @@ func getCustomerID(c *gin.Context) (uint, bool) {
 	return 0, false
 }
 
+// findOrCreateCart loads the customer's cart inside tx and locks the row
+// until the transaction ends, so version checks and writes cannot interleave.
 func findOrCreateCart(tx *gorm.DB, customerID uint) (models.Cart, error) {
 	var cart models.Cart
-	err := tx.Where("customer_id = ?", customerID).First(&cart).Error
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("customer_id = ?", customerID).First(&cart).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			cart = models.Cart{
@@ -354,7 +495,10 @@ func recalcCartTotals(tx *gorm.DB, cartID uint) (int, error) {
 
 	if err := tx.Model(&models.Cart{}).
 		Where("id = ?", cartID).
-		Update("total_amount", result.Total).Error; err != nil {
+		Updates(map[string]interface{}{
+			"total_amount": result.Total,
+			"version":      gorm.Expr("version + 1"),
+		}).Error; err != nil {
 		return 0, err
 	}
 
@@ -385,6 +529,33 @@ func loadOrCreateCart(customerID uint) (models.Cart, error) {
 	return cart, nil
 }
 
+// findCartDrift loads the customer's cart and returns it together with the
+// drifted items that reference one of productIDs.
+func findCartDrift(db *gorm.DB, customerID uint, productIDs []uint) (models.Cart, []models.CartItem, error) {
+	var cart models.Cart
+	err := db.Preload("Items.Product").Where("customer_id = ?", customerID).First(&cart).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Cart{}, nil, nil
+		}
+		return models.Cart{}, nil, err
+	}
+
+	hydrateCart(&cart)
+	wanted := make(map[uint]bool, len(productIDs))
+	for _, id := range productIDs {
+		wanted[id] = true
+	}
+
+	var drifted []models.CartItem
+	for _, item := range cart.Items {
+		if item.Drift != nil && wanted[item.ProductID] {
+			drifted = append(drifted, item)
+		}
+	}
+	return cart, drifted, nil
+}
+
 func loadCartByID(cartID uint) (models.Cart, error) {
 	var cart models.Cart
 	if err := database.DB.Preload("Items.Product").First(&cart, cartID).Error; err != nil {
@@ -395,10 +566,51 @@ func loadCartByID(cartID uint) (models.Cart, error) {
 
 func hydrateCart(cart *models.Cart) {
 	total := 0
+	cart.HasDrift = false
 	for i := range cart.Items {
 		subtotal := cart.Items[i].UnitPrice * cart.Items[i].Quantity
 		cart.Items[i].Subtotal = subtotal
 		total += subtotal
+
+		cart.Items[i].Drift = detectCartItemDrift(&cart.Items[i])
+		if cart.Items[i].Drift != nil {
+			cart.HasDrift = true
+		}
 	}
 	cart.TotalAmount = total
 }
+
+// detectCartItemDrift compares a cart item with its preloaded product and
+// returns nil when the item still matches the product.
+func detectCartItemDrift(item *models.CartItem) *models.ItemDrift {
+	return detectDrift(item.Product, item.UnitPrice, item.Quantity)
+}
+
+// detectDrift compares a price snapshot and wanted quantity with the
+// current product (nil when it was deleted). It returns nil when nothing
+// changed.
+func detectDrift(product *models.Product, snapshotPrice, quantity int) *models.ItemDrift {
+	if product == nil {
+		return &models.ItemDrift{ProductRemoved: true}
+	}
+
+	var drift models.ItemDrift
+	changed := false
+	if product.Price != snapshotPrice {
+		price := product.Price
+		drift.PriceChanged = true
+		drift.CurrentPrice = &price
+		changed = true
+	}
+	if product.Stock != nil && *product.Stock < quantity {
+		stock := *product.Stock
+		drift.InsufficientStock = true
+		drift.AvailableStock = &stock
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return &drift
+}
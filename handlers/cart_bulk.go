@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cartItemResult reports the outcome of one item of a bulk cart request.
+type cartItemResult struct {
+	Index     int    `json:"index"`
+	Op        string `json:"op,omitempty"`
+	ItemID    uint   `json:"item_id,omitempty"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Status    string `json:"status"` // ok, error
+	Error     string `json:"error,omitempty"`
+}
+
+// ReplaceCart replaces the whole item list of the customer's cart. Either
+// every item is applied or, when any item is invalid, nothing is changed
+// and 422 is returned with the per-item results.
+func ReplaceCart(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var input models.ReplaceCartInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	cart, err := findOrCreateCart(tx, customerID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
+
+	productIDs := make([]uint, 0, len(input.Items))
+	for _, item := range input.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	products, err := loadProductsByID(tx, productIDs)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := loadCartItemsByProduct(tx, cart.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]cartItemResult, len(input.Items))
+	seen := map[uint]bool{}
+	failed := false
+	for i, in := range input.Items {
+		results[i] = cartItemResult{Index: i, ProductID: in.ProductID, Status: "ok"}
+
+		var msg string
+		switch {
+		case in.ProductID == 0:
+			msg = "product_id is required"
+		case seen[in.ProductID]:
+			msg = "duplicate product_id"
+		default:
+			msg = validateCartQuantity(products[in.ProductID], in.Quantity)
+		}
+		seen[in.ProductID] = true
+		if msg != "" {
+			results[i].Status = "error"
+			results[i].Error = msg
+			failed = true
+			continue
+		}
+
+		var current *models.CartItem
+		if item, ok := existing[in.ProductID]; ok {
+			current = &item
+		}
+		item, err := setCartItemQuantity(tx, cart.ID, current, products[in.ProductID], in.Quantity)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		results[i].ItemID = item.ID
+	}
+
+	if failed {
+		tx.Rollback()
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "some items are invalid, the cart was not changed",
+			"results": results,
+		})
+		return
+	}
+
+	for productID, item := range existing {
+		if seen[productID] {
+			continue
+		}
+		if err := tx.Delete(&models.CartItem{}, item.ID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	finishBulkCartUpdate(c, tx, cart.ID, results)
+}
+
+// BatchCartItems applies a list of add, update and remove operations to the
+// customer's cart in one transaction. Like ReplaceCart it is all or nothing.
+func BatchCartItems(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var input models.CartBatchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	cart, err := findOrCreateCart(tx, customerID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
+
+	// Updates may name a line by item_id, so the products already in the
+	// cart are loaded too, not only those named by the operations.
+	cartItems, err := loadCartItemsByProduct(tx, cart.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	productIDs := make([]uint, 0, len(input.Operations)+len(cartItems))
+	for _, op := range input.Operations {
+		productIDs = append(productIDs, op.ProductID)
+	}
+	for productID := range cartItems {
+		productIDs = append(productIDs, productID)
+	}
+	products, err := loadProductsByID(tx, productIDs)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]cartItemResult, len(input.Operations))
+	failed := false
+	for i, op := range input.Operations {
+		results[i] = cartItemResult{Index: i, Op: op.Op, ItemID: op.ItemID, ProductID: op.ProductID, Status: "ok"}
+
+		// Items are re-read for every operation because earlier operations
+		// in the batch may have added or removed them.
+		items, err := loadCartItemsByProduct(tx, cart.ID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		msg, err := applyCartBatchOperation(tx, cart.ID, op, items, products, &results[i])
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if msg != "" {
+			results[i].Status = "error"
+			results[i].Error = msg
+			failed = true
+		}
+	}
+
+	if failed {
+		tx.Rollback()
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "some operations are invalid, the cart was not changed",
+			"results": results,
+		})
+		return
+	}
+
+	finishBulkCartUpdate(c, tx, cart.ID, results)
+}
+
+// applyCartBatchOperation applies op and returns a validation message when
+// the operation is invalid. The returned error is reserved for database
+// failures.
+func applyCartBatchOperation(tx *gorm.DB, cartID uint, op models.CartBatchOperation, items map[uint]models.CartItem, products map[uint]models.Product, result *cartItemResult) (string, error) {
+	switch op.Op {
+	case "add":
+		if op.ProductID == 0 {
+			return "product_id is required", nil
+		}
+		if op.Quantity < 1 {
+			return "quantity must be at least 1", nil
+		}
+		existing, inCart := items[op.ProductID]
+		quantity := op.Quantity
+		if inCart {
+			quantity += existing.Quantity
+		}
+		if msg := validateCartQuantity(products[op.ProductID], quantity); msg != "" {
+			return msg, nil
+		}
+		var current *models.CartItem
+		if inCart {
+			current = &existing
+		}
+		item, err := setCartItemQuantity(tx, cartID, current, products[op.ProductID], quantity)
+		if err != nil {
+			return "", err
+		}
+		result.ItemID = item.ID
+		return "", nil
+
+	case "update", "remove":
+		item, found := findBatchTarget(op, items)
+		if !found {
+			return "cart item not found", nil
+		}
+		result.ItemID = item.ID
+		result.ProductID = item.ProductID
+
+		if op.Op == "remove" {
+			return "", tx.Delete(&models.CartItem{}, item.ID).Error
+		}
+		if msg := validateCartQuantity(products[item.ProductID], op.Quantity); msg != "" {
+			return msg, nil
+		}
+		return "", tx.Model(&models.CartItem{}).Where("id = ?", item.ID).Update("quantity", op.Quantity).Error
+
+	default:
+		return "op must be one of add, update, remove", nil
+	}
+}
+
+// findBatchTarget resolves the cart item an update or remove refers to.
+func findBatchTarget(op models.CartBatchOperation, items map[uint]models.CartItem) (models.CartItem, bool) {
+	if op.ItemID != 0 {
+		for _, item := range items {
+			if item.ID == op.ItemID {
+				return item, true
+			}
+		}
+		return models.CartItem{}, false
+	}
+	item, ok := items[op.ProductID]
+	return item, ok && op.ProductID != 0
+}
+
+// validateCartQuantity returns a validation message, or "" when quantity of
+// product may be put in a cart. A zero product means it was not found.
+func validateCartQuantity(product models.Product, quantity int) string {
+	if product.ID == 0 {
+		return "product not found"
+	}
+	if quantity < 1 {
+		return "quantity must be at least 1"
+	}
+	if product.Stock != nil && *product.Stock < quantity {
+		return fmt.Sprintf("only %d in stock", *product.Stock)
+	}
+	return ""
+}
+
+// setCartItemQuantity creates or updates the cart item for product with the
+// given quantity and refreshes its price snapshot, like AddCartItem does.
+func setCartItemQuantity(tx *gorm.DB, cartID uint, existing *models.CartItem, product models.Product, quantity int) (models.CartItem, error) {
+	if existing == nil {
+		item := models.CartItem{
+			CartID:       cartID,
+			ProductID:    product.ID,
+			ProductName:  product.Name,
+			ProductImage: product.Image,
+			UnitPrice:    product.Price,
+			Quantity:     quantity,
+		}
+		return item, tx.Create(&item).Error
+	}
+
+	item := *existing
+	item.Quantity = quantity
+	item.ProductName = product.Name
+	item.ProductImage = product.Image
+	item.UnitPrice = product.Price
+	return item, tx.Save(&item).Error
+}
+
+func loadProductsByID(tx *gorm.DB, ids []uint) (map[uint]models.Product, error) {
+	products := map[uint]models.Product{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+	var list []models.Product
+	if err := tx.Where("id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		products[p.ID] = p
+	}
+	return products, nil
+}
+
+func loadCartItemsByProduct(tx *gorm.DB, cartID uint) (map[uint]models.CartItem, error) {
+	var list []models.CartItem
+	if err := tx.Where("cart_id = ?", cartID).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	items := make(map[uint]models.CartItem, len(list))
+	for _, item := range list {
+		items[item.ProductID] = item
+	}
+	return items, nil
+}
+
+// finishBulkCartUpdate recalculates the total, commits tx and responds with
+// the reloaded cart and the per-item results.
+func finishBulkCartUpdate(c *gin.Context, tx *gorm.DB, cartID uint, results []cartItemResult) {
+	total, err := recalcCartTotals(tx, cartID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := loadCartByID(cartID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hydrateCart(&cart)
+	setETag(c, cart.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"cart":         cart,
+		"results":      results,
+		"total_amount": total,
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"example.com/go-xampp-api/audit"
 	"example.com/go-xampp-api/database"
 	"example.com/go-xampp-api/models"
 	"github.com/gin-gonic/gin"
@@ -39,6 +40,7 @@ func CreateCategory(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	audit.Record(c, audit.ActionCreate, audit.EntityCategory, cat.ID, nil, audit.Snapshot(cat))
 	c.JSON(http.StatusCreated, cat)
 }
 
@@ -49,6 +51,7 @@ func UpdateCategory(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
 		return
 	}
+	before := audit.Snapshot(cat)
 	var input models.Category
 	if err := c.BindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -60,12 +63,19 @@ func UpdateCategory(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	audit.Record(c, audit.ActionUpdate, audit.EntityCategory, cat.ID, before, audit.Snapshot(cat))
 	c.JSON(http.StatusOK, cat)
 }
 
 // ລົບ category
 func DeleteCategory(c *gin.Context) {
-	result := database.DB.Delete(&models.Category{}, c.Param("id"))
+	var cat models.Category
+	if err := database.DB.First(&cat, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+
+	result := database.DB.Delete(&models.Category{}, cat.ID)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -74,5 +84,6 @@ func DeleteCategory(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
 		return
 	}
+	audit.Record(c, audit.ActionDelete, audit.EntityCategory, cat.ID, audit.Snapshot(cat), nil)
 	c.Status(http.StatusNoContent)
 }
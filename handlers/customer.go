@@ -1,15 +1,19 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
 	"example.com/go-xampp-api/database"
 	"example.com/go-xampp-api/models"
 	"example.com/go-xampp-api/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// ເບິ່ງ customers ທັງໝົດ
+// ເບິ່ງ customers ທັງໝົດ (staff only)
 func GetCustomers(c *gin.Context) {
 	var items []models.Customer
 	if err := database.DB.Find(&items).Error; err != nil {
@@ -19,17 +23,18 @@ func GetCustomers(c *gin.Context) {
 	c.JSON(http.StatusOK, items)
 }
 
-// ເບິ່ງ customer ດຽວ
+// ເບິ່ງ customer ດຽວ (staff only)
 func GetCustomer(c *gin.Context) {
 	var customer models.Customer
 	if err := database.DB.Preload("Orders.OrderItems.Product").First(&customer, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
 		return
 	}
+	setETag(c, customer.Version)
 	c.JSON(http.StatusOK, customer)
 }
 
-// ສ້າງ customer ໃໝ່ (Admin only - requires password)
+// ສ້າງ customer ໃໝ່ (staff only - requires password)
 func CreateCustomer(c *gin.Context) {
 	var input struct {
 		Name     string `json:"name" binding:"required"`
@@ -50,16 +55,15 @@ func CreateCustomer(c *gin.Context) {
 		return
 	}
 
-	// Hash password
-	hashedPassword, err := utils.HashPassword(input.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດ hash password ໄດ້"})
+	// ກວດສອບ password policy ແລ້ວ hash
+	hashedPassword, ok := hashNewPassword(c, auth.SubjectCustomer, 0, "", input.Password)
+	if !ok {
 		return
 	}
 
 	customer := models.Customer{
 		Name:     input.Name,
-		Email:    input.Email,
+		Email:    &input.Email,
 		Password: hashedPassword,
 		Phone:    input.Phone,
 		Address:  input.Address,
@@ -72,30 +76,43 @@ func CreateCustomer(c *gin.Context) {
 
 	// Don't return password in response
 	customer.Password = ""
+	audit.Record(c, audit.ActionCreate, audit.EntityCustomer, customer.ID, nil, audit.Snapshot(customer))
+	setETag(c, customer.Version)
 	c.JSON(http.StatusCreated, customer)
 }
 
-// ແກ້ໄຂ customer
+// ແກ້ໄຂ customer (staff only)
 func UpdateCustomer(c *gin.Context) {
 	var customer models.Customer
 	if err := database.DB.First(&customer, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
 		return
 	}
-
-	var input struct {
-		Name     *string `json:"name"`
-		Email    *string `json:"email"`
-		Password *string `json:"password"`
-		Phone    *string `json:"phone"`
-		Address  *string `json:"address"`
+	if customer.ErasedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "customer data was already erased"})
+		return
+	}
+	if !checkIfMatch(c, customer.Version) {
+		return
 	}
+
+	var input models.UpdateCustomerInput
 	if err := c.BindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	updateCustomerProfile(c, customer, input)
+}
+
+// updateCustomerProfile applies the provided fields with a versioned write
+// and answers with the updated customer. A new email must be verified again.
+func updateCustomerProfile(c *gin.Context, customer models.Customer, input models.UpdateCustomerInput) {
+	before := audit.Snapshot(customer)
+
 	// Update fields if provided
+	emailChanged := false
+	oldPassword := ""
 	if input.Name != nil {
 		customer.Name = *input.Name
 	}
@@ -106,15 +123,19 @@ func UpdateCustomer(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "email ຖືກໃຊ້ແລ້ວ"})
 			return
 		}
-		customer.Email = *input.Email
+		if *input.Email != customer.EmailAddress() {
+			customer.EmailVerifiedAt = nil
+			emailChanged = true
+		}
+		customer.Email = input.Email
 	}
 	if input.Password != nil {
-		// Hash new password
-		hashedPassword, err := utils.HashPassword(*input.Password)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດ hash password ໄດ້"})
+		// ກວດສອບ password policy ແລ້ວ hash
+		hashedPassword, ok := hashNewPassword(c, auth.SubjectCustomer, customer.ID, customer.Password, *input.Password)
+		if !ok {
 			return
 		}
+		oldPassword = customer.Password
 		customer.Password = hashedPassword
 	}
 	if input.Phone != nil {
@@ -124,27 +145,78 @@ func UpdateCustomer(c *gin.Context) {
 		customer.Address = *input.Address
 	}
 
-	if err := database.DB.Save(&customer).Error; err != nil {
+	updates := map[string]interface{}{
+		"name":     customer.Name,
+		"email":    customer.Email,
+		"password": customer.Password,
+		"phone":    customer.Phone,
+		"address":  customer.Address,
+	}
+	if emailChanged {
+		updates["email_verified_at"] = nil
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &models.Customer{}, customer.ID, customer.Version, updates); err != nil {
+			return err
+		}
+		if input.Password == nil {
+			return nil
+		}
+		if err := auth.RecordPasswordChange(tx, auth.SubjectCustomer, customer.ID, oldPassword); err != nil {
+			return err
+		}
+		// password ໃໝ່: ອອກຈາກລະບົບທຸກອຸປະກອນ
+		return auth.RevokeSubject(tx, auth.SubjectCustomer, customer.ID)
+	})
+	if err != nil {
+		respondWriteError(c, err, &models.Customer{}, customer.ID)
+		return
+	}
+	if err := database.DB.First(&customer, customer.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if emailChanged {
+		if err := sendVerificationEmail(customer); err != nil {
+			log.Printf("send verification email to customer %d: %v", customer.ID, err)
+		}
+	}
+
+	// ບັນທຶກ audit ສະເພາະການແກ້ໄຂໂດຍ staff
+	if auth.IsStaffRole(c.GetString("role")) {
+		after := audit.Snapshot(customer)
+		if input.Password != nil {
+			after["password_changed"] = true
+		}
+		audit.Record(c, audit.ActionUpdate, audit.EntityCustomer, customer.ID, before, after)
+	}
 
 	// Don't return password in response
 	customer.Password = ""
+	setETag(c, customer.Version)
 	c.JSON(http.StatusOK, customer)
 }
 
-// ລົບ customer
+// ລຶບຂໍ້ມູນສ່ວນຕົວຂອງ customer (staff only). Row ແລະ orders ຍັງຢູ່ສຳລັບບັນຊີ.
 func DeleteCustomer(c *gin.Context) {
-	result := database.DB.Delete(&models.Customer{}, c.Param("id"))
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	var customer models.Customer
+	if err := database.DB.First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+	if customer.ErasedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "customer data was already erased"})
+		return
+	}
+	if !checkIfMatch(c, customer.Version) {
 		return
 	}
+
+	if err := eraseCustomer(customer); err != nil {
+		respondWriteError(c, err, &models.Customer{}, customer.ID)
+		return
+	}
+	audit.Record(c, audit.ActionErase, audit.EntityCustomer, customer.ID, nil, nil)
 	c.Status(http.StatusNoContent)
 }
 
@@ -163,17 +235,16 @@ func CustomerRegister(c *gin.Context) {
 		return
 	}
 
-	// Hash password
-	hashedPassword, err := utils.HashPassword(input.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດ hash password ໄດ້"})
+	// ກວດສອບ password policy ແລ້ວ hash
+	hashedPassword, ok := hashNewPassword(c, auth.SubjectCustomer, 0, "", input.Password)
+	if !ok {
 		return
 	}
 
 	// ສ້າງ customer ໃໝ່
 	customer := models.Customer{
 		Name:     input.Name,
-		Email:    input.Email,
+		Email:    &input.Email,
 		Password: hashedPassword,
 		Phone:    input.Phone,
 		Address:  input.Address,
@@ -184,8 +255,13 @@ func CustomerRegister(c *gin.Context) {
 		return
 	}
 
+	// ສົ່ງລິ້ງຢືນຢັນ email, ລູກຄ້າສາມາດຂໍສົ່ງໃໝ່ໄດ້ຖ້າບໍ່ສຳເລັດ
+	if err := sendVerificationEmail(customer); err != nil {
+		log.Printf("send verification email to customer %d: %v", customer.ID, err)
+	}
+
 	// ສ້າງ token
-	token, err := utils.GenerateToken(customer.ID, customer.Email, "customer")
+	tokens, err := auth.IssueTokens(clientInfo(c), customer.ID, customer.LoginName(), "customer")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
 		return
@@ -194,12 +270,15 @@ func CustomerRegister(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "ລົງທະບຽນສຳເລັດ",
 		"customer": gin.H{
-			"id":    customer.ID,
-			"name":  customer.Name,
-			"email": customer.Email,
-			"phone": customer.Phone,
+			"id":             customer.ID,
+			"name":           customer.Name,
+			"email":          customer.Email,
+			"phone":          customer.Phone,
+			"email_verified": customer.EmailVerifiedAt != nil,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -211,21 +290,32 @@ func CustomerLogin(c *gin.Context) {
 		return
 	}
 
+	// ກວດສອບວ່າຖືກລັອກຍ້ອນເດົາ password ຜິດຫຼາຍຄັ້ງບໍ່
+	accountKey := auth.AccountThrottleKey(auth.SubjectCustomer, input.Email)
+	if !checkLoginThrottle(c, accountKey) {
+		return
+	}
+
 	// ຊອກຫາ customer
 	var customer models.Customer
 	if err := database.DB.Where("email = ?", input.Email).First(&customer).Error; err != nil {
+		utils.SimulatePasswordCheck(input.Password)
+		recordLoginFailure(c, accountKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "email ຫຼື password ບໍ່ຖືກຕ້ອງ"})
 		return
 	}
 
 	// ກວດສອບ password
 	if !utils.CheckPasswordHash(input.Password, customer.Password) {
+		recordLoginFailure(c, accountKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "email ຫຼື password ບໍ່ຖືກຕ້ອງ"})
 		return
 	}
+	upgradePasswordHash(auth.SubjectCustomer, customer.ID, input.Password, customer.Password)
+	recordLoginSuccess(accountKey)
 
 	// ສ້າງ token
-	token, err := utils.GenerateToken(customer.ID, customer.Email, "customer")
+	tokens, err := auth.IssueTokens(clientInfo(c), customer.ID, customer.LoginName(), "customer")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
 		return
@@ -234,11 +324,14 @@ func CustomerLogin(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "ເຂົ້າສູ່ລະບົບສຳເລັດ",
 		"customer": gin.H{
-			"id":    customer.ID,
-			"name":  customer.Name,
-			"email": customer.Email,
-			"phone": customer.Phone,
+			"id":             customer.ID,
+			"name":           customer.Name,
+			"email":          customer.Email,
+			"phone":          customer.Phone,
+			"email_verified": customer.EmailVerifiedAt != nil,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
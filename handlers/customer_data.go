@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// customerExport is everything stored about a customer.
+type customerExport struct {
+	ExportedAt time.Time          `json:"exported_at"`
+	Profile    models.Customer    `json:"profile"`
+	Addresses  []string           `json:"addresses"`
+	Orders     []models.Order     `json:"orders"`
+	Cart       *models.Cart       `json:"cart"`
+	Wishlist   []models.SavedItem `json:"wishlist"`
+	Sessions   []models.Session   `json:"sessions"`
+}
+
+// ດາວໂຫຼດຂໍ້ມູນທັງໝົດຂອງຕົນເອງ (?format=json ຫຼື zip)
+func ExportMyData(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	customer, ok := currentCustomer(c)
+	if !ok {
+		return
+	}
+	export, err := loadCustomerExport(customer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("customer-%d-export-%s", customer.ID, export.ExportedAt.Format("20060102"))
+	c.Header("Cache-Control", "no-store")
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := writeExportZip(c.Writer, export); err != nil {
+		// The headers are sent already; the client gets a broken archive.
+		c.Error(err)
+	}
+}
+
+func loadCustomerExport(customer models.Customer) (customerExport, error) {
+	export := customerExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    customer,
+		Addresses:  []string{},
+	}
+	if err := database.DB.Preload("OrderItems").
+		Where("customer_id = ?", customer.ID).
+		Order("created_at DESC").
+		Find(&export.Orders).Error; err != nil {
+		return export, err
+	}
+
+	var cart models.Cart
+	if err := database.DB.Preload("Items").Where("customer_id = ?", customer.ID).Limit(1).Find(&cart).Error; err != nil {
+		return export, err
+	}
+	if cart.ID != 0 {
+		hydrateCart(&cart)
+		export.Cart = &cart
+	}
+
+	if err := database.DB.Where("customer_id = ?", customer.ID).Find(&export.Wishlist).Error; err != nil {
+		return export, err
+	}
+	sessions, err := auth.ListSessions(auth.SubjectCustomer, customer.ID)
+	if err != nil {
+		return export, err
+	}
+	export.Sessions = sessions
+
+	// ທີ່ຢູ່ທັງໝົດທີ່ເຄີຍໃຊ້ (profile ແລະ ທີ່ຢູ່ຈັດສົ່ງ), ບໍ່ຊ້ຳກັນ
+	seen := map[string]bool{"": true}
+	for _, address := range append([]string{customer.Address}, orderAddresses(export.Orders)...) {
+		if !seen[address] {
+			seen[address] = true
+			export.Addresses = append(export.Addresses, address)
+		}
+	}
+	return export, nil
+}
+
+func orderAddresses(orders []models.Order) []string {
+	addresses := make([]string, 0, len(orders))
+	for _, order := range orders {
+		addresses = append(addresses, order.ShippingAddress)
+	}
+	return addresses
+}
+
+// writeExportZip writes one JSON file per part of the export.
+func writeExportZip(w http.ResponseWriter, export customerExport) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"addresses.json", export.Addresses},
+		{"orders.json", export.Orders},
+		{"cart.json", export.Cart},
+		{"wishlist.json", export.Wishlist},
+		{"sessions.json", export.Sessions},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ລຶບຂໍ້ມູນສ່ວນຕົວຂອງຕົນເອງ. Orders ຍັງເກັບໄວ້ສຳລັບບັນຊີ ແຕ່ບໍ່ມີຂໍ້ມູນສ່ວນຕົວ.
+func EraseMyAccount(c *gin.Context) {
+	var input models.EraseAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, ok := currentCustomer(c)
+	if !ok {
+		return
+	}
+	// customer ທີ່ລົງທະບຽນດ້ວຍເບີໂທບໍ່ມີ password
+	if customer.Password != "" && !utils.CheckPasswordHash(input.Password, customer.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password ບໍ່ຖືກຕ້ອງ"})
+		return
+	}
+
+	if err := eraseCustomer(customer); err != nil {
+		respondWriteError(c, err, &models.Customer{}, customer.ID)
+		return
+	}
+	audit.Record(c, audit.ActionErase, audit.EntityCustomer, customer.ID, nil, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// eraseCustomer anonymizes the customer's personal data and shipping
+// addresses, also in the audit log, while keeping order totals and items
+// for accounting. The cart, wishlist, tokens and sessions are removed. It returns
+// errStaleVersion when the customer changed since it was loaded.
+func eraseCustomer(customer models.Customer) error {
+	now := time.Now()
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &models.Customer{}, customer.ID, customer.Version, map[string]interface{}{
+			"name":              models.ErasedValue,
+			"email":             nil,
+			"login_phone":       nil,
+			"phone":             "",
+			"address":           "",
+			"password":          "",
+			"email_verified_at": nil,
+			"erased_at":         now,
+		}); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Order{}).Where("customer_id = ?", customer.ID).Updates(map[string]interface{}{
+			"shipping_address": models.ErasedValue,
+			"version":          gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+
+		cartIDs := tx.Model(&models.Cart{}).Select("id").Where("customer_id = ?", customer.ID)
+		if err := tx.Where("cart_id IN (?)", cartIDs).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.Cart{}, &models.SavedItem{}, &models.CartReminder{}} {
+			if err := tx.Where("customer_id = ?", customer.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		for _, model := range []interface{}{&models.ActionToken{}, &models.PasswordHistory{}} {
+			if err := tx.Where("subject_type = ? AND subject_id = ?", auth.SubjectCustomer, customer.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if customer.LoginPhone != nil {
+			if err := tx.Where("phone = ?", *customer.LoginPhone).Delete(&models.PhoneOTP{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := audit.RedactCustomer(tx, customer.ID); err != nil {
+			return err
+		}
+		return auth.RevokeSubject(tx, auth.SubjectCustomer, customer.ID)
+	})
+}
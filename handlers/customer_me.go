@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ເບິ່ງຂໍ້ມູນຂອງ customer ທີ່ເຂົ້າສູ່ລະບົບ
+func GetMyProfile(c *gin.Context) {
+	customer, ok := currentCustomer(c)
+	if !ok {
+		return
+	}
+	setETag(c, customer.Version)
+	c.JSON(http.StatusOK, customer)
+}
+
+// ແກ້ໄຂຂໍ້ມູນຂອງຕົນເອງ (ຮອງຮັບ If-Match)
+func UpdateMyProfile(c *gin.Context) {
+	customer, ok := currentCustomer(c)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(c, customer.Version) {
+		return
+	}
+
+	var input models.UpdateProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updateCustomerProfile(c, customer, models.UpdateCustomerInput{
+		Name:    input.Name,
+		Email:   input.Email,
+		Phone:   input.Phone,
+		Address: input.Address,
+	})
+}
+
+// ປ່ຽນ password (ຕ້ອງໃສ່ password ປັດຈຸບັນ). ອຸປະກອນອື່ນຈະຖືກອອກຈາກລະບົບ.
+func ChangeMyPassword(c *gin.Context) {
+	var input models.ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, ok := currentCustomer(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.CurrentPassword, customer.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password ປັດຈຸບັນບໍ່ຖືກຕ້ອງ"})
+		return
+	}
+
+	hashedPassword, ok := hashNewPassword(c, auth.SubjectCustomer, customer.ID, customer.Password, input.NewPassword)
+	if !ok {
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	if err := updateVersioned(tx, &models.Customer{}, customer.ID, customer.Version, map[string]interface{}{"password": hashedPassword}); err != nil {
+		tx.Rollback()
+		respondWriteError(c, err, &models.Customer{}, customer.ID)
+		return
+	}
+
+	if err := auth.RecordPasswordChange(tx, auth.SubjectCustomer, customer.ID, customer.Password); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ຍົກເລີກທຸກ token ເກົ່າ ແລ້ວອອກ token ໃໝ່ໃຫ້ອຸປະກອນນີ້
+	if err := auth.RevokeSubject(tx, auth.SubjectCustomer, customer.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := auth.IssueTokens(clientInfo(c), customer.ID, customer.LoginName(), "customer")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "ປ່ຽນ password ສຳເລັດ",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// ເບິ່ງ orders ຂອງຕົນເອງ, ໃໝ່ສຸດກ່ອນ
+func GetMyOrders(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var orders []models.Order
+	if err := database.DB.Preload("OrderItems.Product").
+		Where("customer_id = ?", customerID).
+		Order("created_at DESC").
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// currentCustomer loads the customer of the current token.
+func currentCustomer(c *gin.Context) (models.Customer, bool) {
+	var customer models.Customer
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return customer, false
+	}
+	if err := database.DB.First(&customer, customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+		return customer, false
+	}
+	return customer, true
+}
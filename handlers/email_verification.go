@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/notify"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// VerifyEmail confirms a customer's email with the token from the
+// verification link. The token is read from the "token" query parameter
+// (link clicked in the email) or from the JSON body.
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var input models.VerifyEmailInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token = input.Token
+	}
+
+	tx := database.DB.Begin()
+
+	actionToken, err := auth.ConsumeActionToken(tx, models.ActionVerifyEmail, token)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := tx.Model(&models.Customer{}).
+		Where("id = ?", actionToken.SubjectID).
+		Updates(map[string]interface{}{
+			"email_verified_at": time.Now(),
+			"version":           gorm.Expr("version + 1"),
+		}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ຢືນຢັນ email ສຳເລັດ"})
+}
+
+// ResendVerificationEmail sends a new verification link to the logged-in
+// customer. Sending is limited to one email per
+// EMAIL_VERIFICATION_RESEND_INTERVAL and a few per day.
+func ResendVerificationEmail(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var customer models.Customer
+	if err := database.DB.First(&customer, customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+		return
+	}
+	if customer.Email == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "customer has no email"})
+		return
+	}
+	if customer.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email is already verified"})
+		return
+	}
+
+	retryAfter, err := verificationRetryAfter(customer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many verification emails, try again later"})
+		return
+	}
+
+	if err := sendVerificationEmail(customer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "ສົ່ງລິ້ງຢືນຢັນ email ແລ້ວ"})
+}
+
+// sendVerificationEmail issues a verification token for the customer's
+// current email and mails the link. Older links stop working. Customers
+// without email are skipped.
+func sendVerificationEmail(customer models.Customer) error {
+	if customer.Email == nil {
+		return nil
+	}
+	token, err := auth.CreateActionToken(database.DB, models.ActionVerifyEmail, auth.SubjectCustomer, customer.ID, config.Current.EmailVerification.TTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.Current.EmailVerification.URL + "?token=" + url.QueryEscape(token)
+	notify.SendAsync(notify.Message{
+		To:      *customer.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.",
+			customer.Name, link, config.Current.EmailVerification.TTL),
+	})
+	return nil
+}
+
+// verificationRetryAfter returns how long the customer has to wait before
+// another verification email may be sent, or 0.
+func verificationRetryAfter(customerID uint) (time.Duration, error) {
+	var sent []models.ActionToken
+	if err := database.DB.
+		Where("purpose = ? AND subject_type = ? AND subject_id = ? AND created_at > ?",
+			models.ActionVerifyEmail, auth.SubjectCustomer, customerID, time.Now().Add(-24*time.Hour)).
+		Order("created_at DESC").
+		Find(&sent).Error; err != nil {
+		return 0, err
+	}
+	if len(sent) == 0 {
+		return 0, nil
+	}
+
+	if wait := time.Until(sent[0].CreatedAt.Add(config.Current.EmailVerification.ResendInterval)); wait > 0 {
+		return wait, nil
+	}
+	if len(sent) >= config.Current.EmailVerification.MaxPerDay {
+		oldest := sent[len(sent)-1]
+		return time.Until(oldest.CreatedAt.Add(24 * time.Hour)), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/go-xampp-api/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errStaleVersion is returned when a row changed after it was loaded.
+var errStaleVersion = errors.New("resource was modified by another request")
+
+// setETag exposes an entity version as the response ETag.
+func setETag(c *gin.Context, version uint) {
+	c.Header("ETag", formatETag(version))
+}
+
+func formatETag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// checkIfMatch compares the If-Match request header with the current
+// version. It writes 412 and returns false when the client holds a stale
+// version; requests without If-Match are allowed.
+func checkIfMatch(c *gin.Context, version uint) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || ifMatchAllows(header, version) {
+		return true
+	}
+	respondStale(c, version)
+	return false
+}
+
+// ifMatchAllows reports whether any entity tag in header matches version.
+// Weak tags are accepted because some proxies weaken ETags.
+func ifMatchAllows(header string, version uint) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		tag = strings.TrimPrefix(tag, "W/")
+		if tag == formatETag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+func respondStale(c *gin.Context, currentVersion uint) {
+	setETag(c, currentVersion)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":           "precondition failed",
+		"message":         "the resource was changed by someone else, reload it and try again",
+		"current_version": currentVersion,
+	})
+}
+
+// updateVersioned applies updates to the row with the given id only if it
+// still has version, and bumps the version. It returns errStaleVersion when
+// the row was changed concurrently.
+func updateVersioned(db *gorm.DB, model interface{}, id uint, version uint, updates map[string]interface{}) error {
+	updates["version"] = gorm.Expr("version + 1")
+	result := db.Model(model).Where("id = ? AND version = ?", id, version).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errStaleVersion
+	}
+	return nil
+}
+
+// deleteVersioned deletes the row with the given id only if it still has
+// version.
+func deleteVersioned(db *gorm.DB, model interface{}, id uint, version uint) error {
+	result := db.Where("id = ? AND version = ?", id, version).Delete(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errStaleVersion
+	}
+	return nil
+}
+
+// respondWriteError answers a failed versioned write: 412 with the current
+// version for errStaleVersion, 404 when the row is gone, 500 otherwise.
+func respondWriteError(c *gin.Context, err error, model interface{}, id uint) {
+	if !errors.Is(err, errStaleVersion) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var versions []uint
+	if err := database.DB.Model(model).Where("id = ?", id).Pluck("version", &versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	respondStale(c, versions[0])
+}
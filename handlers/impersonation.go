@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// staff ເຂົ້າໃຊ້ແທນ customer ເພື່ອເບິ່ງ cart ແລະ orders ຄືກັບທີ່ customer ເຫັນ (staff only).
+// Token ມີອາຍຸສັ້ນ, ບໍ່ມີ refresh token ແລະ ທຸກ request ຖືກບັນທຶກ.
+func ImpersonateCustomer(c *gin.Context) {
+	actor, ok := currentStaffUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.ImpersonateCustomerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var customer models.Customer
+	if err := database.DB.First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+		return
+	}
+	if customer.ErasedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "customer data was already erased"})
+		return
+	}
+
+	token, err := auth.IssueImpersonationToken(actor, customer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
+		return
+	}
+	audit.Record(c, audit.ActionImpersonate, audit.EntityCustomer, customer.ID, nil, map[string]interface{}{
+		"reason":     input.Reason,
+		"token_id":   token.ID,
+		"expires_at": token.ExpiresAt,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "ກຳລັງໃຊ້ແທນ customer, ບາງລາຍການເຊັ່ນ ປ່ຽນ password ຖືກປິດໄວ້",
+		"impersonated": true,
+		"customer": gin.H{
+			"id":   customer.ID,
+			"name": customer.Name,
+		},
+		"token":      token.Token,
+		"expires_in": int64(config.Current.Auth.ImpersonationTTL.Seconds()),
+	})
+}
+
+// ເບິ່ງ requests ທີ່ staff ເຮັດໃນຂະນະໃຊ້ແທນ customer (admin only).
+// Filters: actor_id, customer_id, token_id; page ແລະ page_size.
+func GetImpersonatedRequests(c *gin.Context) {
+	query := database.DB.Model(&models.ImpersonatedRequest{})
+	for _, field := range []string{"actor_id", "customer_id"} {
+		if v := c.Query(field); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": field + " must be a number"})
+				return
+			}
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	if v := c.Query("token_id"); v != "" {
+		query = query.Where("token_id = ?", v)
+	}
+
+	page, pageSize, ok := parsePagination(c, defaultAuditPageSize, maxAuditPageSize)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []models.ImpersonatedRequest
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":     entries,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
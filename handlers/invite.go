@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/notify"
+	"github.com/gin-gonic/gin"
+)
+
+// ເບິ່ງ invites ທັງໝົດ (admin only)
+func GetInvites(c *gin.Context) {
+	var invites []models.UserInvite
+	if err := database.DB.Order("created_at DESC").Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, invites)
+}
+
+// ສ້າງ invite ສຳລັບ staff ໃໝ່ (admin only). Token ສະແດງຄັ້ງດຽວ.
+func CreateInvite(c *gin.Context) {
+	if c.GetString("auth_method") == "api_key" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create invites"})
+		return
+	}
+
+	var input models.CreateInviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl := config.Current.Auth.InviteTTL
+	if input.ExpiresInHours > 0 {
+		ttl = time.Duration(input.ExpiresInHours) * time.Hour
+	}
+
+	invite, token, err := auth.CreateInvite(input.Role, input.Email, ttl, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(c, audit.ActionCreate, audit.EntityInvite, invite.ID, nil, audit.Snapshot(invite))
+
+	link := config.Current.Auth.InviteURL + "?invite=" + url.QueryEscape(token)
+	if invite.Email != "" {
+		notify.SendAsync(notify.Message{
+			To:      invite.Email,
+			Subject: "You are invited to the admin panel",
+			Body: fmt.Sprintf("Hello,\n\n%s invited you as %s. Use this link to create your account. It expires on %s and works once:\n\n%s",
+				c.GetString("username"), invite.Role, invite.ExpiresAt.Format(time.RFC1123), link),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invite":       invite,
+		"invite_token": token,
+		"invite_url":   link,
+	})
+}
+
+// ຍົກເລີກ invite ທີ່ຍັງບໍ່ໄດ້ໃຊ້ (admin only)
+func RevokeInvite(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invite id"})
+		return
+	}
+
+	revoked, err := auth.RevokeInvite(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unused invite not found"})
+		return
+	}
+	audit.Record(c, audit.ActionRevoke, audit.EntityInvite, uint(id), nil, nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+
+	"example.com/go-xampp-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ເຜີຍແຜ່ public keys ສຳລັບກວດສອບ access token (RFC 7517)
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.JWKS()})
+}
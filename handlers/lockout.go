@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ListLoginLockouts shows the accounts and IPs that are locked or have
+// recent failed logins (admin only).
+func ListLoginLockouts(c *gin.Context) {
+	throttles, err := auth.ListLoginThrottles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, throttles)
+}
+
+// UnlockLogin clears the failed attempts and lock of an account or IP
+// (admin only).
+func UnlockLogin(c *gin.Context) {
+	var input models.UnlockLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := input.Key
+	switch {
+	case key != "":
+	case input.IP != "":
+		key = auth.IPThrottleKey(input.IP)
+	case input.AccountType != "" && input.Identifier != "":
+		key = auth.AccountThrottleKey(input.AccountType, input.Identifier)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key, ip or account_type with identifier is required"})
+		return
+	}
+
+	found, err := auth.UnlockLogin(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no failed logins for " + key})
+		return
+	}
+	audit.Record(c, audit.ActionUnlock, audit.EntityLoginThrottle, 0, nil, map[string]interface{}{"key": key})
+	c.JSON(http.StatusOK, gin.H{"message": "ປົດລັອກສຳເລັດ", "key": key})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+// ເລີ່ມເຂົ້າສູ່ລະບົບ staff ຜ່ານ OpenID Connect: redirect ໄປຫາ identity provider
+func OIDCLogin(c *gin.Context) {
+	if !auth.OIDCEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	authURL, err := auth.StartOIDCLogin(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCProvider) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// identity provider ສົ່ງກັບມາທີ່ນີ້ພ້ອມ code. ສ້າງບັນຊີ staff ໃໝ່ໃນການເຂົ້າສູ່ລະບົບຄັ້ງທຳອິດ.
+func OIDCCallback(c *gin.Context) {
+	if !auth.OIDCEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": idpError, "error_description": c.Query("error_description")})
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+		return
+	}
+
+	before, user, err := auth.FinishOIDCLogin(c.Request.Context(), state, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidOIDCState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrOIDCNoRole), errors.Is(err, auth.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrOIDCEmailInUse), errors.Is(err, auth.ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrOIDCProvider):
+			log.Printf("oidc callback: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// ການປ່ຽນແປງບັນຊີຈາກ identity provider ບັນທຶກໃນ audit log ໂດຍມີຜູ້ໃຊ້ຄົນນັ້ນເປັນຜູ້ກະທຳ
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	if before.ID == 0 {
+		audit.Record(c, audit.ActionCreate, audit.EntityUser, user.ID, nil, audit.Snapshot(user))
+	} else {
+		audit.Record(c, audit.ActionUpdate, audit.EntityUser, user.ID, audit.Snapshot(before), audit.Snapshot(user))
+	}
+
+	// 2FA ຂອງລະບົບນີ້ຍັງໃຊ້ຢູ່, ເວັ້ນແຕ່ຕັ້ງ OIDC_TRUST_IDP_MFA (identity provider ບັງຄັບ MFA ເອງ)
+	if !config.Current.OIDC.TrustIdPMFA {
+		step, err := secondFactorStep(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if step != nil {
+			respondOIDCResult(c, step)
+			return
+		}
+	}
+
+	if config.Current.OIDC.SuccessURL == "" {
+		respondUserLogin(c, user, http.StatusOK)
+		return
+	}
+	tokens, err := auth.IssueTokens(clientInfo(c), user.ID, user.Username, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
+		return
+	}
+	respondOIDCResult(c, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// respondOIDCResult sends the tokens or the 2FA step of an OIDC login:
+// as JSON, or to OIDC_SUCCESS_URL in the URL fragment, which is neither
+// sent to servers nor logged.
+func respondOIDCResult(c *gin.Context, result gin.H) {
+	if config.Current.OIDC.SuccessURL == "" {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	fragment := url.Values{}
+	for k, v := range result {
+		if k != "message" {
+			fragment.Set(k, fmt.Sprint(v))
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, config.Current.OIDC.SuccessURL+"#"+fragment.Encode())
+}
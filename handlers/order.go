@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
 	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/jobs"
 	"example.com/go-xampp-api/models"
 	"example.com/go-xampp-api/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ເບິ່ງ orders ທັງໝົດ
@@ -17,10 +24,10 @@ func GetOrders(c *gin.Context) {
 	var items []models.Order
 	query := database.DB.Preload("Customer").Preload("OrderItems.Product")
 
-	// Determine access: default to customer-restricted unless role is explicitly admin
+	// Determine access: default to customer-restricted unless role is explicitly staff
 	if v, ok := c.Get("role"); ok {
-		if role, ok2 := v.(string); ok2 && role == "admin" {
-			// admin: no filtering
+		if role, ok2 := v.(string); ok2 && auth.IsStaffRole(role) {
+			// admin/staff: no filtering
 		} else {
 			// customer or unknown role: restrict
 			if cid, ok3 := c.Get("customer_id"); ok3 {
@@ -62,10 +69,10 @@ func GetOrder(c *gin.Context) {
 		return
 	}
 
-	// Enforce customer-only access unless explicit admin role
+	// Enforce customer-only access unless explicit staff role
 	if v, ok := c.Get("role"); ok {
-		if role, ok2 := v.(string); ok2 && role == "admin" {
-			// admin allowed
+		if role, ok2 := v.(string); ok2 && auth.IsStaffRole(role) {
+			// admin/staff allowed
 		} else {
 			if cid, ok3 := c.Get("customer_id"); ok3 {
 				if order.CustomerID != cid {
@@ -86,6 +93,7 @@ func GetOrder(c *gin.Context) {
 		}
 	}
 
+	setETag(c, order.Version)
 	c.JSON(http.StatusOK, order)
 }
 
@@ -110,6 +118,10 @@ func CreateOrder(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "customer not found"})
 				return
 			}
+			if config.Current.EmailVerification.RequiredForOrders && customer.EmailVerifiedAt == nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "please verify your email before placing an order"})
+				return
+			}
 		}
 	} else {
 		// Guest checkout ຫຼື customer ໃໝ່ - ຊອກຫາຫຼືສ້າງ customer ຈາກ email
@@ -142,7 +154,7 @@ func CreateOrder(c *gin.Context) {
 
 			customer = models.Customer{
 				Name:     customerName,
-				Email:    input.Email,
+				Email:    &input.Email,
 				Phone:    "", // Can be added later
 				Address:  "", // Can be added later
 				Password: hashedPassword,
@@ -185,6 +197,41 @@ func CreateOrder(c *gin.Context) {
 
 	// ເລີ່ມ transaction
 	tx := database.DB.Begin()
+
+	// Lock the products (in id order, so two checkouts cannot deadlock) until
+	// the order is written: the price and stock checked below are the ones
+	// the order gets.
+	productIDs := make([]uint, 0, len(input.Items))
+	for _, item := range input.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var locked []models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", productIDs).Order("id").Find(&locked).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Customers must accept cart price/stock changes before checking out
+	if exists && role == "customer" {
+		cart, drifted, err := findCartDrift(tx, customerID, productIDs)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(drifted) > 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "cart items changed since they were added, refresh the cart before checkout",
+				"drifted_items": drifted,
+				"cart":          cart,
+			})
+			return
+		}
+	}
+
 	if err := tx.Create(&order).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -202,6 +249,31 @@ func CreateOrder(c *gin.Context) {
 			return
 		}
 
+		// ຫັກ stock ຖ້າສິນຄ້ານີ້ຕິດຕາມ stock; version ປ່ຽນນຳ ເພື່ອໃຫ້ ETag ຂອງສິນຄ້າບໍ່ເກົ່າ
+		if product.Stock != nil {
+			result := tx.Model(&models.Product{}).
+				Where("id = ? AND stock >= ?", product.ID, item.Quantity).
+				Updates(map[string]interface{}{
+					"stock":   gorm.Expr("stock - ?", item.Quantity),
+					"version": gorm.Expr("version + 1"),
+				})
+			if result.Error != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+				return
+			}
+			if result.RowsAffected == 0 {
+				tx.Rollback()
+				c.JSON(http.StatusConflict, gin.H{
+					"error":           "insufficient stock",
+					"product_id":      product.ID,
+					"requested":       item.Quantity,
+					"available_stock": *product.Stock,
+				})
+				return
+			}
+		}
+
 		orderItem := models.OrderItem{
 			OrderID:   order.ID,
 			ProductID: item.ProductID,
@@ -221,7 +293,7 @@ func CreateOrder(c *gin.Context) {
 
 	// ອັບເດດ total amount
 	order.TotalAmount = totalAmount
-	if err := tx.Save(&order).Error; err != nil {
+	if err := tx.Model(&order).Update("total_amount", totalAmount).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -229,12 +301,22 @@ func CreateOrder(c *gin.Context) {
 
 	tx.Commit()
 
+	// ບັນທຶກວ່າການແຈ້ງເຕືອນ cart ທີ່ຖືກປະໄວ້ນຳໄປສູ່ order
+	if err := jobs.RecordCartConversion(database.DB, customerID, order.ID); err != nil {
+		log.Printf("record cart conversion for order %d: %v", order.ID, err)
+	}
+
 	// ໂຫຼດ order ພ້ອມກັບ relationships
 	if err := database.DB.Preload("Customer").Preload("OrderItems.Product").First(&order, order.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if auth.IsStaffRole(c.GetString("role")) {
+		audit.Record(c, audit.ActionCreate, audit.EntityOrder, order.ID, nil, audit.Snapshot(order))
+	}
+
+	setETag(c, order.Version)
 	c.JSON(http.StatusCreated, order)
 }
 
@@ -245,6 +327,11 @@ func UpdateOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
 		return
 	}
+	if !checkIfMatch(c, order.Version) {
+		return
+	}
+
+	before := audit.Snapshot(order)
 
 	var input models.UpdateOrderStatusInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -252,9 +339,9 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	order.Status = input.Status
-	if err := database.DB.Save(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	updates := map[string]interface{}{"status": input.Status}
+	if err := updateVersioned(database.DB, &models.Order{}, order.ID, order.Version, updates); err != nil {
+		respondWriteError(c, err, &models.Order{}, order.ID)
 		return
 	}
 
@@ -263,35 +350,41 @@ func UpdateOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	audit.Record(c, audit.ActionUpdate, audit.EntityOrder, order.ID, before, audit.Snapshot(order))
 
+	setETag(c, order.Version)
 	c.JSON(http.StatusOK, order)
 }
 
 // ລົບ order
 func DeleteOrder(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if !checkIfMatch(c, order.Version) {
+		return
+	}
+
 	// ເລີ່ມ transaction ເພື່ອລົບ order items ກ່ອນ
 	tx := database.DB.Begin()
 
 	// ລົບ order items ກ່ອນ
-	if err := tx.Where("order_id = ?", c.Param("id")).Delete(&models.OrderItem{}).Error; err != nil {
+	if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderItem{}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// ລົບ order
-	result := tx.Delete(&models.Order{}, c.Param("id"))
-	if result.Error != nil {
+	// ລົບ order, ຖ້າ version ບໍ່ກົງ rollback ທັງໝົດ
+	if err := deleteVersioned(tx, &models.Order{}, order.ID, order.Version); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
-		return
-	}
-	if result.RowsAffected == 0 {
-		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		respondWriteError(c, err, &models.Order{}, order.ID)
 		return
 	}
 
 	tx.Commit()
+	audit.Record(c, audit.ActionDelete, audit.EntityOrder, order.ID, audit.Snapshot(order), nil)
 	c.Status(http.StatusNoContent)
 }
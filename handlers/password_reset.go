@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/notify"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequestPasswordReset emails a reset link to the account with the given
+// email. The response is the same whether or not the account exists.
+func RequestPasswordReset(c *gin.Context) {
+	var input models.PasswordResetRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subjectType := auth.SubjectCustomer
+	if input.AccountType == "user" {
+		subjectType = auth.SubjectUser
+	}
+
+	subjectID, name, err := findAccountByEmail(subjectType, input.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err == nil {
+		token, err := auth.CreateActionToken(database.DB, models.ActionPasswordReset, subjectType, subjectID, config.Current.Auth.PasswordResetTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		link := config.Current.Auth.PasswordResetURL + "?token=" + url.QueryEscape(token)
+		notify.SendAsync(notify.Message{
+			To:      input.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hello %s,\n\nUse this link to choose a new password. It expires in %s and works once:\n\n%s\n\nIf you did not ask for this, ignore this email.",
+				name, config.Current.Auth.PasswordResetTTL, link),
+		})
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "ຖ້າ email ນີ້ມີຢູ່ໃນລະບົບ, ພວກເຮົາໄດ້ສົ່ງລິ້ງ reset password ໄປແລ້ວ",
+	})
+}
+
+// ConfirmPasswordReset sets a new password with a reset token and revokes
+// every existing session of the account.
+func ConfirmPasswordReset(c *gin.Context) {
+	var input models.PasswordResetConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ກວດສອບ token ກ່ອນ ເພື່ອຮູ້ວ່າເປັນບັນຊີໃດ ແລ້ວຈຶ່ງກວດ password policy
+	pending, err := auth.FindActionToken(database.DB, models.ActionPasswordReset, input.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	currentHash, err := currentPasswordHash(pending.SubjectType, pending.SubjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	hashedPassword, ok := hashNewPassword(c, pending.SubjectType, pending.SubjectID, currentHash, input.Password)
+	if !ok {
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	token, err := auth.ConsumeActionToken(tx, models.ActionPasswordReset, input.Token)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var model interface{} = &models.User{}
+	updates := map[string]interface{}{"password": hashedPassword}
+	if token.SubjectType == auth.SubjectCustomer {
+		model = &models.Customer{}
+		updates["version"] = gorm.Expr("version + 1")
+	}
+	if err := tx.Model(model).Where("id = ?", token.SubjectID).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := auth.RecordPasswordChange(tx, token.SubjectType, token.SubjectID, currentHash); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := auth.RevokeSubject(tx, token.SubjectType, token.SubjectID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ປ່ຽນ password ສຳເລັດ, ກະລຸນາເຂົ້າສູ່ລະບົບໃໝ່"})
+}
+
+// currentPasswordHash returns the stored password hash of a user or
+// customer.
+func currentPasswordHash(subjectType string, subjectID uint) (string, error) {
+	var model interface{} = &models.User{}
+	if subjectType == auth.SubjectCustomer {
+		model = &models.Customer{}
+	}
+	var hashes []string
+	if err := database.DB.Model(model).Where("id = ?", subjectID).Pluck("password", &hashes).Error; err != nil {
+		return "", err
+	}
+	if len(hashes) == 0 {
+		return "", nil
+	}
+	return hashes[0], nil
+}
+
+// findAccountByEmail returns the id and display name of a user or customer.
+func findAccountByEmail(subjectType, email string) (uint, string, error) {
+	if subjectType == auth.SubjectUser {
+		var user models.User
+		if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+			return 0, "", err
+		}
+		return user.ID, user.Username, nil
+	}
+
+	var customer models.Customer
+	if err := database.DB.Where("email = ?", email).First(&customer).Error; err != nil {
+		return 0, "", err
+	}
+	return customer.ID, customer.Name, nil
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/notify"
+	"example.com/go-xampp-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ຂໍລະຫັດເຂົ້າສູ່ລະບົບທາງ SMS (ໃຊ້ໄດ້ທັງລົງທະບຽນ ແລະ ເຂົ້າສູ່ລະບົບ)
+func RequestPhoneCode(c *gin.Context) {
+	var input models.PhoneCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phone, ok := normalizePhone(c, input.Phone)
+	if !ok {
+		return
+	}
+
+	code, retryAfter, err := auth.IssuePhoneOTP(phone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "ສົ່ງລະຫັດຫຼາຍເກີນໄປ, ກະລຸນາລອງໃໝ່ພາຍຫຼັງ"})
+		return
+	}
+
+	notify.SendSMSAsync(notify.SMS{
+		To:   phone,
+		Body: "Rice API code: " + code + ". Do not share this code.",
+	})
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "ສົ່ງລະຫັດທາງ SMS ແລ້ວ",
+		"phone":      phone,
+		"expires_in": int64(config.Current.Phone.OTPTTL.Seconds()),
+	})
+}
+
+// ເຂົ້າສູ່ລະບົບ customer ດ້ວຍເບີໂທ ແລະ ລະຫັດ SMS
+func PhoneLogin(c *gin.Context) {
+	var input models.PhoneLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phone, ok := normalizePhone(c, input.Phone)
+	if !ok {
+		return
+	}
+
+	accountKey := auth.AccountThrottleKey(auth.SubjectCustomer, phone)
+	if !checkLoginThrottle(c, accountKey) {
+		return
+	}
+
+	var customer models.Customer
+	err := database.DB.Where("login_phone = ?", phone).Limit(1).Find(&customer).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ເບີທີ່ຍັງບໍ່ລົງທະບຽນ: ລະຫັດຍັງໃຊ້ໄດ້ຕໍ່ທີ່ POST /customers/phone/register
+	registered := customer.ID != 0
+	if !verifyPhoneCode(c, accountKey, phone, input.Code, registered) {
+		return
+	}
+	if !registered {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":                 "ເບີໂທນີ້ຍັງບໍ່ໄດ້ລົງທະບຽນ",
+			"registration_required": true,
+		})
+		return
+	}
+	recordLoginSuccess(accountKey)
+
+	respondCustomerLogin(c, customer, http.StatusOK, "ເຂົ້າສູ່ລະບົບສຳເລັດ")
+}
+
+// ລົງທະບຽນ customer ດ້ວຍເບີໂທ (ບໍ່ຕ້ອງມີ email ຫຼື password)
+func PhoneRegister(c *gin.Context) {
+	var input models.PhoneRegisterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phone, ok := normalizePhone(c, input.Phone)
+	if !ok {
+		return
+	}
+
+	accountKey := auth.AccountThrottleKey(auth.SubjectCustomer, phone)
+	if !checkLoginThrottle(c, accountKey) {
+		return
+	}
+	// ກວດລະຫັດກ່ອນ ເພື່ອບໍ່ໃຫ້ບອກວ່າເບີໃດລົງທະບຽນແລ້ວ
+	if !verifyPhoneCode(c, accountKey, phone, input.Code, false) {
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.Customer{}).Where("login_phone = ?", phone).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "ເບີໂທນີ້ຖືກໃຊ້ແລ້ວ"})
+		return
+	}
+
+	if !verifyPhoneCode(c, accountKey, phone, input.Code, true) {
+		return
+	}
+	recordLoginSuccess(accountKey)
+
+	customer := models.Customer{
+		Name:       input.Name,
+		Phone:      phone,
+		LoginPhone: &phone,
+		Address:    input.Address,
+	}
+	if err := database.DB.Create(&customer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondCustomerLogin(c, customer, http.StatusCreated, "ລົງທະບຽນສຳເລັດ")
+}
+
+// respondCustomerLogin issues tokens for a customer who registered or
+// logged in with a phone number.
+func respondCustomerLogin(c *gin.Context, customer models.Customer, status int, message string) {
+	tokens, err := auth.IssueTokens(clientInfo(c), customer.ID, customer.LoginName(), "customer")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"message": message,
+		"customer": gin.H{
+			"id":             customer.ID,
+			"name":           customer.Name,
+			"email":          customer.Email,
+			"phone":          customer.Phone,
+			"login_phone":    customer.LoginPhone,
+			"email_verified": customer.EmailVerifiedAt != nil,
+		},
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// normalizePhone answers 400 and returns false for numbers that cannot be
+// converted to E.164.
+func normalizePhone(c *gin.Context, raw string) (string, bool) {
+	phone, err := utils.NormalizePhone(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return phone, true
+}
+
+// verifyPhoneCode checks an SMS code and counts a wrong one as a failed
+// login. It answers 401 and returns false when the code is not valid.
+func verifyPhoneCode(c *gin.Context, accountKey, phone, code string, consume bool) bool {
+	err := auth.VerifyPhoneOTP(phone, code, consume)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, auth.ErrInvalidPhoneOTP) {
+		recordLoginFailure(c, accountKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return false
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -10,6 +13,8 @@ import (
 	"strings"
 	"time"
 
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/config"
 	"example.com/go-xampp-api/database"
 	"example.com/go-xampp-api/models"
 	"github.com/gin-gonic/gin"
@@ -34,6 +39,7 @@ func GetProduct(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
+	setETag(c, p.Version)
 	c.JSON(http.StatusOK, p)
 }
 
@@ -65,30 +71,52 @@ func CreateProduct(c *gin.Context) {
 			}
 		}
 
+		var stock *int
+		if v := c.PostForm("stock"); v != "" {
+			iv, err := strconv.Atoi(v)
+			if err != nil || iv < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "stock must be a non-negative number"})
+				return
+			}
+			stock = &iv
+		}
+
 		// Handle image upload
 		file, _ := c.FormFile("image")
 		var imagePath *string
 		if file != nil {
 			savedPath, err := saveUploadedFile(c, file)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respondUploadError(c, err)
 				return
 			}
 			imagePath = &savedPath
 		}
 
-		p = models.Product{Name: name, Price: price, CategoryID: categoryID, Image: imagePath}
+		p = models.Product{Name: name, Price: price, CategoryID: categoryID, Image: imagePath, Stock: stock}
 	} else {
-		if err := c.BindJSON(&p); err != nil {
+		// id and version are set by the database, not by the client
+		type createProductInput struct {
+			Name       string  `json:"name"`
+			Price      int     `json:"price"`
+			CategoryID *uint   `json:"category_id"`
+			Image      *string `json:"image"`
+			Stock      *int    `json:"stock" binding:"omitempty,min=0"`
+		}
+		var in createProductInput
+		if err := c.BindJSON(&in); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		p = models.Product{Name: in.Name, Price: in.Price, CategoryID: in.CategoryID, Image: in.Image, Stock: in.Stock}
 	}
 
 	if err := database.DB.Create(&p).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	audit.Record(c, audit.ActionCreate, audit.EntityProduct, p.ID, nil, audit.Snapshot(p))
+	setETag(c, p.Version)
 	c.JSON(http.StatusCreated, p)
 }
 
@@ -99,6 +127,10 @@ func UpdateProduct(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
+	if !checkIfMatch(c, p.Version) {
+		return
+	}
+	before := audit.Snapshot(p)
 
 	if strings.Contains(strings.ToLower(c.Request.Header.Get("Content-Type")), "multipart/form-data") {
 		updates := map[string]interface{}{}
@@ -121,19 +153,27 @@ func UpdateProduct(c *gin.Context) {
 				return
 			}
 		}
+		if v := c.PostForm("stock"); v != "" {
+			if iv, err := strconv.Atoi(v); err == nil && iv >= 0 {
+				updates["stock"] = iv
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "stock must be a non-negative number"})
+				return
+			}
+		}
 		// image file
 		file, _ := c.FormFile("image")
 		if file != nil {
 			savedPath, err := saveUploadedFile(c, file)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respondUploadError(c, err)
 				return
 			}
 			updates["image"] = savedPath
 		}
 		if len(updates) > 0 {
-			if err := database.DB.Model(&p).Select("name", "price", "category_id", "image").Updates(updates).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if err := updateVersioned(database.DB, &models.Product{}, p.ID, p.Version, updates); err != nil {
+				respondWriteError(c, err, &models.Product{}, p.ID)
 				return
 			}
 		}
@@ -144,6 +184,7 @@ func UpdateProduct(c *gin.Context) {
 			Price      *int    `json:"price"`
 			CategoryID *uint   `json:"category_id"`
 			Image      *string `json:"image"`
+			Stock      *int    `json:"stock"`
 		}
 		var in updateProductInput
 		if err := c.BindJSON(&in); err != nil {
@@ -163,9 +204,16 @@ func UpdateProduct(c *gin.Context) {
 		if in.Image != nil {
 			updates["image"] = *in.Image
 		}
+		if in.Stock != nil {
+			if *in.Stock < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "stock must be a non-negative number"})
+				return
+			}
+			updates["stock"] = *in.Stock
+		}
 		if len(updates) > 0 {
-			if err := database.DB.Model(&p).Select("name", "price", "category_id", "image").Updates(updates).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if err := updateVersioned(database.DB, &models.Product{}, p.ID, p.Version, updates); err != nil {
+				respondWriteError(c, err, &models.Product{}, p.ID)
 				return
 			}
 		}
@@ -176,36 +224,97 @@ func UpdateProduct(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	audit.Record(c, audit.ActionUpdate, audit.EntityProduct, p.ID, before, audit.Snapshot(p))
+	setETag(c, p.Version)
 	c.JSON(http.StatusOK, p)
 }
 
-// saveUploadedFile stores the file under ./uploads and returns the relative path
+// errInvalidUpload marks an upload refused by the upload settings; the
+// client gets 400 instead of 500.
+var errInvalidUpload = errors.New("invalid upload")
+
+// imageExtensions names stored files by their detected type, not by the
+// name the client sent.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// saveUploadedFile stores the file in the upload directory and returns the
+// path it is served at. Files over uploads.max_bytes or whose content is
+// not one of uploads.allowed_types are refused with errInvalidUpload.
 func saveUploadedFile(c *gin.Context, file *multipart.FileHeader) (string, error) {
+	cfg := config.Current.Uploads
+	if file.Size > cfg.MaxBytes {
+		return "", fmt.Errorf("%w: image is larger than %d bytes", errInvalidUpload, cfg.MaxBytes)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	allowed := false
+	for _, t := range cfg.AllowedTypes {
+		if strings.EqualFold(t, contentType) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("%w: image type %s is not allowed, use %s", errInvalidUpload, contentType, strings.Join(cfg.AllowedTypes, ", "))
+	}
+
 	// Ensure uploads directory exists
-	if err := os.MkdirAll("uploads", 0755); err != nil {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
 		return "", err
 	}
-	// Keep original extension, generate unique name
-	ext := filepath.Ext(file.Filename)
+	ext := imageExtensions[contentType]
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
 	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	dst := filepath.Join("uploads", filename)
-	if err := c.SaveUploadedFile(file, dst); err != nil {
+	if err := c.SaveUploadedFile(file, filepath.Join(cfg.Dir, filename)); err != nil {
 		return "", err
 	}
 	// Expose via /uploads in main.go
 	return "/uploads/" + filename, nil
 }
 
+// respondUploadError answers 400 for refused uploads and 500 otherwise.
+func respondUploadError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidUpload) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
 // ລົບ product
 func DeleteProduct(c *gin.Context) {
-	result := database.DB.Delete(&models.Product{}, c.Param("id"))
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	var p models.Product
+	if err := database.DB.First(&p, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	if !checkIfMatch(c, p.Version) {
+		return
+	}
+
+	if err := deleteVersioned(database.DB, &models.Product{}, p.ID, p.Version); err != nil {
+		respondWriteError(c, err, &models.Product{}, p.ID)
 		return
 	}
+	audit.Record(c, audit.ActionDelete, audit.EntityProduct, p.ID, audit.Snapshot(p), nil)
 	c.Status(http.StatusNoContent)
 }
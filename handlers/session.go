@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ເບິ່ງອຸປະກອນທີ່ບັນຊີນີ້ເຂົ້າສູ່ລະບົບຢູ່
+func GetSessions(c *gin.Context) {
+	subjectType, subjectID, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := auth.ListSessions(subjectType, subjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessionsResponse(sessions, c.GetUint("session_id")))
+}
+
+// ອອກຈາກລະບົບໃນອຸປະກອນໃດໜຶ່ງຂອງຕົນເອງ
+func DeleteSession(c *gin.Context) {
+	subjectType, subjectID, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+	sessionID, ok := parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := auth.RevokeSession(sessionID, subjectType, subjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ເບິ່ງ sessions ຂອງບັນຊີໃດໜຶ່ງ (admin only): ?account_type=user|customer&account_id=1
+func GetAccountSessions(c *gin.Context) {
+	accountType := c.Query("account_type")
+	if accountType != auth.SubjectUser && accountType != auth.SubjectCustomer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_type must be user or customer"})
+		return
+	}
+	accountID, err := strconv.ParseUint(c.Query("account_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_id must be a number"})
+		return
+	}
+
+	sessions, err := auth.ListSessions(accountType, uint(accountID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessionsResponse(sessions, 0))
+}
+
+// ຍົກເລີກ session ໃດໜຶ່ງຂອງບັນຊີໃດກໍໄດ້ (admin only)
+func AdminDeleteSession(c *gin.Context) {
+	sessionID, ok := parseSessionID(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := auth.RevokeSession(sessionID, "", 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	audit.Record(c, audit.ActionRevoke, audit.EntitySession, sessionID, nil, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// ບັງຄັບໃຫ້ບັນຊີອອກຈາກລະບົບທຸກອຸປະກອນ (admin only)
+func ForceLogout(c *gin.Context) {
+	var input models.ForceLogoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := auth.RevokeSubject(database.DB, input.AccountType, input.AccountID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// account_type is user or customer, the same names as the audit entity types
+	audit.Record(c, audit.ActionForceLogout, input.AccountType, input.AccountID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "ບັນຊີຖືກອອກຈາກລະບົບທຸກອຸປະກອນແລ້ວ"})
+}
+
+// clientInfo describes the device of the current request for its session.
+func clientInfo(c *gin.Context) auth.Client {
+	return auth.Client{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Device:    c.GetHeader("X-Device-Name"),
+	}
+}
+
+// currentSubject returns the account of the current JWT. API keys have no
+// sessions and are rejected.
+func currentSubject(c *gin.Context) (string, uint, bool) {
+	if c.GetString("auth_method") == "api_key" || c.GetUint("user_id") == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "ບໍ່ມີສິດເຂົ້າເຖິງ"})
+		return "", 0, false
+	}
+	return auth.SubjectTypeForRole(c.GetString("role")), c.GetUint("user_id"), true
+}
+
+func parseSessionID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// sessionsResponse marks the session of the current token.
+func sessionsResponse(sessions []models.Session, currentID uint) []gin.H {
+	items := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, gin.H{
+			"id":           s.ID,
+			"device":       s.Device,
+			"ip":           s.IP,
+			"user_agent":   s.UserAgent,
+			"created_at":   s.CreatedAt,
+			"last_seen_at": s.LastSeenAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      currentID != 0 && s.ID == currentID,
+		})
+	}
+	return items
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ຢືນຢັນ 2FA ຫຼັງຈາກ password ຖືກ: ສົ່ງ challenge_token ກັບ code ຫຼື recovery_code
+func LoginTwoFactor(c *gin.Context) {
+	var input models.LoginTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (input.Code == "") == (input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "send either code or recovery_code"})
+		return
+	}
+
+	challenge, err := auth.FindActionToken(database.DB, models.ActionLogin2FA, input.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, challenge.SubjectID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidActionToken.Error()})
+		return
+	}
+
+	// ລະຫັດ 2FA ຜິດນັບເປັນການເຂົ້າສູ່ລະບົບຜິດຄືກັນ
+	accountKey := auth.AccountThrottleKey(auth.SubjectUser, user.Username)
+	if !checkLoginThrottle(c, accountKey) {
+		return
+	}
+
+	if input.Code != "" {
+		err = auth.VerifyUserTOTP(&user, input.Code)
+	} else {
+		err = auth.UseRecoveryCode(user.ID, input.RecoveryCode)
+	}
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidTOTPCode) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordLoginFailure(c, accountKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// challenge ໃຊ້ໄດ້ຄັ້ງດຽວ
+	if _, err := auth.ConsumeActionToken(database.DB, models.ActionLogin2FA, input.ChallengeToken); err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	recordLoginSuccess(accountKey)
+
+	respondUserLogin(c, user, http.StatusOK)
+}
+
+// ເບິ່ງສະຖານະ 2FA ຂອງຜູ້ໃຊ້ປັດຈຸບັນ
+func GetTwoFactorStatus(c *gin.Context) {
+	user, ok := currentStaffUser(c)
+	if !ok {
+		return
+	}
+
+	remaining, err := auth.RemainingRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	policy, err := auth.GetSecurityPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabledAt != nil,
+		"enabled_at":               user.TOTPEnabledAt,
+		"required":                 policy.RequireStaff2FA,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// ເລີ່ມຕັ້ງຄ່າ 2FA: ສ້າງ secret ໃໝ່ ແລະ URI ສຳລັບ QR code
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := currentStaffUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA ເປີດໃຊ້ຢູ່ແລ້ວ"})
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Model(&user).Update("totp_pending_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPProvisioningURI(secret, user.Username),
+	})
+}
+
+// ຢືນຢັນລະຫັດທຳອິດແລ້ວເປີດ 2FA. ສົ່ງ recovery codes ກັບຄືນຄັ້ງດຽວ.
+func EnableTwoFactor(c *gin.Context) {
+	var input models.TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentStaffUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA ເປີດໃຊ້ຢູ່ແລ້ວ"})
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "call POST /auth/2fa/setup first"})
+		return
+	}
+
+	step, err := auth.MatchTOTP(user.TOTPPendingSecret, input.Code, 0, time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidTOTPCode.Error()})
+		return
+	}
+
+	var codes []string
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":         user.TOTPPendingSecret,
+			"totp_pending_secret": "",
+			"totp_last_step":      step,
+			"totp_enabled_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = auth.GenerateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"message":        "ເປີດໃຊ້ 2FA ສຳເລັດ, ເກັບ recovery codes ໄວ້ບ່ອນປອດໄພ",
+		"recovery_codes": codes,
+	}
+
+	// ຖ້າຕັ້ງຄ່າດ້ວຍ enrollment token, ປ່ຽນເປັນ token ປົກກະຕິເລີຍ
+	if c.GetString("token_purpose") == auth.PurposeTOTPEnrollment {
+		if err := auth.RevokeAccessToken(c.GetString("token_id"), c.GetTime("token_expires_at")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		tokens, err := auth.IssueTokens(clientInfo(c), user.ID, user.Username, user.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ບໍ່ສາມາດສ້າງ token ໄດ້"})
+			return
+		}
+		response["token"] = tokens.AccessToken
+		response["refresh_token"] = tokens.RefreshToken
+		response["expires_in"] = tokens.ExpiresIn
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ປິດ 2FA (ຕ້ອງໃສ່ password ແລະ ລະຫັດ 2FA). ບໍ່ອະນຸຍາດເມື່ອ policy ບັງຄັບ.
+func DisableTwoFactor(c *gin.Context) {
+	var input models.DisableTOTPInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentStaffUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA ບໍ່ໄດ້ເປີດໃຊ້"})
+		return
+	}
+
+	policy, err := auth.GetSecurityPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if policy.RequireStaff2FA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "2FA is mandatory for staff"})
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password ບໍ່ຖືກຕ້ອງ"})
+		return
+	}
+	if !verifyTwoFactorCode(c, &user, input.Code) {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      0,
+			"totp_enabled_at":     nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ປິດ 2FA ສຳເລັດ"})
+}
+
+// ສ້າງ recovery codes ຊຸດໃໝ່ (ຊຸດເກົ່າໃຊ້ບໍ່ໄດ້ອີກ)
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input models.TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentStaffUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA ບໍ່ໄດ້ເປີດໃຊ້"})
+		return
+	}
+	if !verifyTwoFactorCode(c, &user, input.Code) {
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ເບິ່ງ security policy (admin only)
+func GetSecurityPolicy(c *gin.Context) {
+	policy, err := auth.GetSecurityPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// ແກ້ໄຂ security policy (admin only)
+func UpdateSecurityPolicy(c *gin.Context) {
+	var input models.SecurityPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := auth.GetSecurityPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	policy := models.SecurityPolicy{
+		RequireStaff2FA: *input.RequireStaff2FA,
+		UpdatedByID:     c.GetUint("user_id"),
+	}
+	if err := auth.SaveSecurityPolicy(policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err = auth.GetSecurityPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(c, audit.ActionUpdate, audit.EntitySecurityPolicy, policy.ID, audit.Snapshot(before), audit.Snapshot(policy))
+	c.JSON(http.StatusOK, policy)
+}
+
+// currentStaffUser loads the staff user of the current JWT. API keys have
+// no user and are rejected.
+func currentStaffUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if c.GetString("auth_method") == "api_key" || c.GetUint("user_id") == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "ບໍ່ມີສິດເຂົ້າເຖິງ"})
+		return user, false
+	}
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ບໍ່ພົບຜູ້ໃຊ້"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return user, false
+	}
+	return user, true
+}
+
+// verifyTwoFactorCode answers 401 and returns false for a wrong code.
+func verifyTwoFactorCode(c *gin.Context, user *models.User, code string) bool {
+	if err := auth.VerifyUserTOTP(user, code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTOTPCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/notify"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// ເບິ່ງ staff users ທັງໝົດ (admin only). Filters: role, status=active|disabled,
+// q (username ຫຼື email); page ແລະ page_size.
+func GetUsers(c *gin.Context) {
+	query := database.DB.Model(&models.User{})
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("status") {
+	case "":
+	case "active":
+		query = query.Where("disabled_at IS NULL")
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or disabled"})
+		return
+	}
+	if q := c.Query("q"); q != "" {
+		query = query.Where("username LIKE ? OR email LIKE ?", "%"+q+"%", "%"+q+"%")
+	}
+
+	page, pageSize, ok := parsePagination(c, defaultUserPageSize, maxUserPageSize)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":     users,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// ເບິ່ງ staff user ຕາມ ID (admin only)
+func GetUser(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// ປິດການໃຊ້ງານ staff user ແລະ ອອກຈາກລະບົບທຸກອຸປະກອນ (admin only)
+func DisableUser(c *gin.Context) {
+	setUserDisabled(c, true)
+}
+
+// ເປີດການໃຊ້ງານ staff user ຄືນ (admin only)
+func EnableUser(c *gin.Context) {
+	setUserDisabled(c, false)
+}
+
+func setUserDisabled(c *gin.Context, disabled bool) {
+	if !rejectAPIKey(c) {
+		return
+	}
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	before, after, err := auth.SetUserDisabled(id, disabled)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	audit.Record(c, audit.ActionUpdate, audit.EntityUser, id, audit.Snapshot(before), audit.Snapshot(after))
+	c.JSON(http.StatusOK, after)
+}
+
+// ປ່ຽນ role ຂອງ staff user (admin only). ຜູ້ໃຊ້ຕ້ອງເຂົ້າສູ່ລະບົບໃໝ່.
+func UpdateUserRole(c *gin.Context) {
+	if !rejectAPIKey(c) {
+		return
+	}
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.UpdateUserRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, after, err := auth.ChangeUserRole(id, input.Role)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	audit.Record(c, audit.ActionUpdate, audit.EntityUser, id, audit.Snapshot(before), audit.Snapshot(after))
+	c.JSON(http.StatusOK, after)
+}
+
+// Reset password ຂອງ staff user (admin only): password ເກົ່າໃຊ້ບໍ່ໄດ້ອີກ,
+// ອອກຈາກລະບົບທຸກອຸປະກອນ ແລະ ສົ່ງລິ້ງຕັ້ງ password ໃໝ່ທາງ email.
+func ResetUserPassword(c *gin.Context) {
+	if !rejectAPIKey(c) {
+		return
+	}
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	user, token, err := auth.ResetUserPassword(id)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	link := config.Current.Auth.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	notify.SendAsync(notify.Message{
+		To:      user.Email,
+		Subject: "Your password was reset",
+		Body: fmt.Sprintf("Hello %s,\n\nAn administrator reset your password and signed you out. Use this link to choose a new password. It expires in %s and works once:\n\n%s",
+			user.Username, config.Current.Auth.PasswordResetTTL, link),
+	})
+	audit.Record(c, audit.ActionUpdate, audit.EntityUser, id, nil, map[string]interface{}{"password_reset": true})
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "ສົ່ງລິ້ງຕັ້ງ password ໃໝ່ໄປທີ່ email ຂອງຜູ້ໃຊ້ແລ້ວ",
+		"expires_in": int64(config.Current.Auth.PasswordResetTTL.Seconds()),
+	})
+}
+
+// ລຶບ staff user (admin only)
+func DeleteUser(c *gin.Context) {
+	if !rejectAPIKey(c) {
+		return
+	}
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	before, err := auth.DeleteUser(id)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	audit.Record(c, audit.ActionDelete, audit.EntityUser, id, audit.Snapshot(before), nil)
+	c.Status(http.StatusNoContent)
+}
+
+// rejectAPIKey answers 403 for API keys: managing staff accounts needs a
+// person behind the request.
+func rejectAPIKey(c *gin.Context) bool {
+	if c.GetString("auth_method") == "api_key" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot manage users"})
+		return false
+	}
+	return true
+}
+
+func parseUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondUserError maps errors of the user management functions in auth.
+func respondUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "ບໍ່ພົບຜູ້ໃຊ້"})
+	case errors.Is(err, auth.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetSavedItems lists the customer's saved-for-later products and flags the
+// ones whose price changed or that went out of stock since they were saved.
+func GetSavedItems(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var items []models.SavedItem
+	if err := database.DB.Preload("Product").
+		Where("customer_id = ?", customerID).
+		Order("created_at DESC").
+		Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hasDrift := hydrateSavedItems(items)
+	c.JSON(http.StatusOK, gin.H{
+		"items":     items,
+		"has_drift": hasDrift,
+	})
+}
+
+// AddSavedItem saves a product for later. Saving a product again refreshes
+// its saved price and quantity.
+func AddSavedItem(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var input models.SaveItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
+
+	var product models.Product
+	if err := database.DB.First(&product, input.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	item, err := saveForLater(database.DB, customerID, product.ID, product.Price, input.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	item.Product = &product
+	hydrateSavedItems([]models.SavedItem{item})
+	c.JSON(http.StatusCreated, item)
+}
+
+// DeleteSavedItem removes a product from the saved list.
+func DeleteSavedItem(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid saved item id"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND customer_id = ?", itemID, customerID).Delete(&models.SavedItem{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved item not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// MoveSavedItemToCart moves a saved product into the cart at the current
+// product price and removes it from the saved list.
+func MoveSavedItemToCart(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid saved item id"})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	var saved models.SavedItem
+	if err := tx.Preload("Product").Where("id = ? AND customer_id = ?", itemID, customerID).First(&saved).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "saved item not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if saved.Product == nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "product is no longer available"})
+		return
+	}
+
+	cart, err := findOrCreateCart(tx, customerID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
+
+	var current *models.CartItem
+	quantity := saved.Quantity
+	var existing models.CartItem
+	err = tx.Where("cart_id = ? AND product_id = ?", cart.ID, saved.ProductID).First(&existing).Error
+	if err == nil {
+		current = &existing
+		quantity += existing.Quantity
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := validateCartQuantity(*saved.Product, quantity); msg != "" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+		return
+	}
+
+	if _, err := setCartItemQuantity(tx, cart.ID, current, *saved.Product, quantity); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Delete(&models.SavedItem{}, saved.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := recalcCartTotals(tx, cart.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err = loadCartByID(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hydrateCart(&cart)
+	setETag(c, cart.Version)
+	c.JSON(http.StatusOK, cart)
+}
+
+// SaveCartItemForLater moves a cart item to the saved list, keeping the
+// price the customer saw in the cart.
+func SaveCartItemForLater(c *gin.Context) {
+	customerID, ok := getCustomerID(c)
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cart item id"})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	cart, err := findOrCreateCart(tx, customerID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkIfMatch(c, cart.Version) {
+		tx.Rollback()
+		return
+	}
+
+	var item models.CartItem
+	if err := tx.Where("id = ? AND cart_id = ?", itemID, cart.ID).First(&item).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cart item not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	saved, err := saveForLater(tx, customerID, item.ProductID, item.UnitPrice, item.Quantity)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Delete(&models.CartItem{}, item.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := recalcCartTotals(tx, cart.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err = loadCartByID(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hydrateCart(&cart)
+	setETag(c, cart.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"cart":       cart,
+		"saved_item": saved,
+	})
+}
+
+// saveForLater creates or refreshes the customer's saved item for a product.
+func saveForLater(tx *gorm.DB, customerID, productID uint, price, quantity int) (models.SavedItem, error) {
+	var item models.SavedItem
+	err := tx.Where("customer_id = ? AND product_id = ?", customerID, productID).First(&item).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.SavedItem{}, err
+	}
+
+	item.CustomerID = customerID
+	item.ProductID = productID
+	item.SavedPrice = price
+	item.Quantity = quantity
+	return item, tx.Save(&item).Error
+}
+
+// hydrateSavedItems sets the drift flags of items and reports whether any
+// item drifted.
+func hydrateSavedItems(items []models.SavedItem) bool {
+	hasDrift := false
+	for i := range items {
+		items[i].Drift = detectDrift(items[i].Product, items[i].SavedPrice, items[i].Quantity)
+		if items[i].Drift != nil {
+			hasDrift = true
+		}
+	}
+	return hasDrift
+}
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/go-xampp-api/config"
+	"example.com/go-xampp-api/database"
+	"example.com/go-xampp-api/models"
+	"example.com/go-xampp-api/notify"
+	"gorm.io/gorm"
+)
+
+// AbandonedCartJob finds carts that have not changed for cfg.After, queues
+// a reminder for each of them and delivers queued reminders through sender.
+type AbandonedCartJob struct {
+	cfg    config.AbandonedCart
+	sender notify.Sender
+}
+
+func NewAbandonedCartJob(cfg config.AbandonedCart, sender notify.Sender) *AbandonedCartJob {
+	return &AbandonedCartJob{cfg: cfg, sender: sender}
+}
+
+// Run performs one detection and delivery pass.
+func (j *AbandonedCartJob) Run(ctx context.Context) error {
+	if err := j.queueReminders(ctx); err != nil {
+		return err
+	}
+	return j.deliverReminders(ctx)
+}
+
+// queueReminders creates one queued reminder per abandoned cart state. A
+// cart that changes after a reminder gets a new reminder once it has been
+// left alone again.
+func (j *AbandonedCartJob) queueReminders(ctx context.Context) error {
+	cutoff := time.Now().Add(-j.cfg.After)
+
+	var carts []models.Cart
+	err := database.DB.WithContext(ctx).
+		Where("carts.updated_at < ?", cutoff).
+		Where("EXISTS (SELECT 1 FROM cart_items WHERE cart_items.cart_id = carts.id)").
+		Where("NOT EXISTS (SELECT 1 FROM cart_reminders WHERE cart_reminders.cart_id = carts.id AND cart_reminders.cart_updated_at = carts.updated_at)").
+		Where("NOT EXISTS (SELECT 1 FROM orders WHERE orders.customer_id = carts.customer_id AND orders.created_at > carts.updated_at)").
+		// Customers who registered with a phone number have no email to remind.
+		Where("EXISTS (SELECT 1 FROM customers WHERE customers.id = carts.customer_id AND customers.email IS NOT NULL)").
+		Limit(j.cfg.BatchSize).
+		Find(&carts).Error
+	if err != nil {
+		return err
+	}
+
+	for _, cart := range carts {
+		reminder := models.CartReminder{
+			CartID:        cart.ID,
+			CustomerID:    cart.CustomerID,
+			CartUpdatedAt: cart.UpdatedAt,
+			CartTotal:     cart.TotalAmount,
+			Status:        models.CartReminderQueued,
+		}
+		if err := database.DB.WithContext(ctx).Create(&reminder).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *AbandonedCartJob) deliverReminders(ctx context.Context) error {
+	var reminders []models.CartReminder
+	err := database.DB.WithContext(ctx).
+		Where("status = ? AND attempts < ?", models.CartReminderQueued, j.cfg.MaxAttempts).
+		Order("id").
+		Limit(j.cfg.BatchSize).
+		Find(&reminders).Error
+	if err != nil {
+		return err
+	}
+
+	for _, reminder := range reminders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		updates := map[string]interface{}{"attempts": reminder.Attempts + 1}
+		if err := j.send(ctx, reminder); err != nil {
+			updates["last_error"] = err.Error()
+			if reminder.Attempts+1 >= j.cfg.MaxAttempts {
+				updates["status"] = models.CartReminderFailed
+			}
+		} else {
+			updates["status"] = models.CartReminderSent
+			updates["sent_at"] = time.Now()
+			updates["last_error"] = ""
+		}
+
+		if err := database.DB.WithContext(ctx).Model(&models.CartReminder{}).
+			Where("id = ?", reminder.ID).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *AbandonedCartJob) send(ctx context.Context, reminder models.CartReminder) error {
+	var customer models.Customer
+	if err := database.DB.WithContext(ctx).First(&customer, reminder.CustomerID).Error; err != nil {
+		return err
+	}
+	if customer.Email == nil {
+		return fmt.Errorf("customer %d has no email", customer.ID)
+	}
+
+	var items []models.CartItem
+	if err := database.DB.WithContext(ctx).Where("cart_id = ?", reminder.CartID).Find(&items).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("cart %d is empty", reminder.CartID)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\nYou left these items in your cart:\n\n", customer.Name)
+	for _, item := range items {
+		fmt.Fprintf(&body, "- %s x %d\n", item.ProductName, item.Quantity)
+	}
+	fmt.Fprintf(&body, "\nTotal: %d\n\nComplete your order: %s\n", reminder.CartTotal, j.cfg.CartURL)
+
+	return j.sender.Send(ctx, notify.Message{
+		To:      *customer.Email,
+		Subject: "You left something in your cart",
+		Body:    body.String(),
+	})
+}
+
+// RecordCartConversion marks the customer's sent, unconverted reminders as
+// converted by orderID.
+func RecordCartConversion(db *gorm.DB, customerID, orderID uint) error {
+	return db.Model(&models.CartReminder{}).
+		Where("customer_id = ? AND status = ? AND converted_at IS NULL", customerID, models.CartReminderSent).
+		Updates(map[string]interface{}{
+			"converted_at": time.Now(),
+			"order_id":     orderID,
+		}).Error
+}
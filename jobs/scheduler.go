@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Scheduler runs periodic background jobs and lets the caller wait for
+// running jobs to finish after their context is cancelled.
+type Scheduler struct {
+	wg sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every runs fn immediately and then every interval until ctx is cancelled.
+// A run in progress is never interrupted by the ticker.
+func (s *Scheduler) Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("job %s failed: %v", name, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until every job started with Every has returned.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
@@ -1,75 +1,306 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"example.com/go-xampp-api/auth"
+	"example.com/go-xampp-api/config"
 	"example.com/go-xampp-api/database"
 	"example.com/go-xampp-api/handlers"
+	"example.com/go-xampp-api/jobs"
 	"example.com/go-xampp-api/middleware"
+	"example.com/go-xampp-api/notify"
+	"example.com/go-xampp-api/utils"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// One-off commands, e.g. `go run . bootstrap-admin -email admin@example.com`
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// Configuration: file (-config), env ແລະ flags, e.g. `go run . -config config.yaml -server.addr :9000`
+	if err := config.Init(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal(err)
+	}
+	cfg := config.Current
+
+	// JWT signing keys (ບໍ່ຍອມ start ດ້ວຍ secret ເລີ່ມຕົ້ນນອກ development)
+	if err := utils.InitJWTKeys(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Password hasher ແລະ policy (ໂຫຼດລາຍການ password ທີ່ຮົ່ວໄຫຼ)
+	if err := utils.InitPasswordPolicy(); err != nil {
+		log.Fatal(err)
+	}
+
+	// OpenID Connect login ສຳລັບ staff (ເມື່ອຕັ້ງ OIDC_ISSUER)
+	if err := auth.InitOIDC(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize database
 	database.InitDB()
 
+	// Notifications (email and SMS)
+	sender, err := notify.FromConfig(cfg.Notify)
+	if err != nil {
+		log.Fatal(err)
+	}
+	notify.Default = sender
+	smsSender, err := notify.SMSFromConfig(cfg.Notify)
+	if err != nil {
+		log.Fatal(err)
+	}
+	notify.DefaultSMS = smsSender
+
+	// SIGINT/SIGTERM stop the background jobs and start the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background jobs
+	scheduler := jobs.NewScheduler()
+	startJobs(ctx, scheduler)
+
 	r := gin.Default()
 
 	// Add CORS middleware
 	r.Use(middleware.CORSMiddleware())
 
+	// Request body limit (413); product images are further limited by uploads.max_bytes
+	r.Use(middleware.BodyLimit(cfg.Server.MaxBodyBytes))
+
 	// Serve uploaded files
-	r.Static("/uploads", "./uploads")
+	r.Static("/uploads", cfg.Uploads.Dir)
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
 
-	// AUTH routes (Admin/User)
+	// Public keys for verifying access tokens in other services
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
+	// AUTH routes (Admin/User). Registration requires an invite from an admin.
 	r.POST("/register", handlers.Register)
 	r.POST("/login", handlers.Login)
+	r.POST("/auth/refresh", handlers.RefreshToken)
+	r.POST("/auth/logout", middleware.AuthMiddleware(), handlers.Logout)
+	r.POST("/login/2fa", handlers.LoginTwoFactor)
+	r.POST("/auth/password-reset/request", handlers.RequestPasswordReset)
+	r.POST("/auth/password-reset/confirm", handlers.ConfirmPasswordReset)
+	r.GET("/auth/oidc/login", handlers.OIDCLogin)
+	r.GET("/auth/oidc/callback", handlers.OIDCCallback)
+
+	// TWO-FACTOR routes (Admin/User). Enrollment tokens from /login work here only.
+	twoFactorRoutes := r.Group("/auth/2fa")
+	twoFactorRoutes.Use(middleware.AllowTokenPurpose(auth.PurposeTOTPEnrollment), middleware.AuthMiddleware(), middleware.RequireRole("admin", "staff"))
+	{
+		twoFactorRoutes.GET("", handlers.GetTwoFactorStatus)
+		twoFactorRoutes.POST("/setup", handlers.SetupTwoFactor)
+		twoFactorRoutes.POST("/enable", handlers.EnableTwoFactor)
+		twoFactorRoutes.POST("/disable", handlers.DisableTwoFactor)
+		twoFactorRoutes.POST("/recovery-codes", handlers.RegenerateRecoveryCodes)
+	}
+
+	// SESSION routes (current user or customer)
+	r.GET("/sessions", middleware.AuthMiddleware(), handlers.GetSessions)
+	r.DELETE("/sessions/:id", middleware.AuthMiddleware(), middleware.DenyImpersonation(), handlers.DeleteSession)
 
 	// CUSTOMER AUTH routes
 	r.POST("/customers/register", handlers.CustomerRegister)
 	r.POST("/customers/login", handlers.CustomerLogin)
+	r.POST("/customers/phone/code", handlers.RequestPhoneCode)
+	r.POST("/customers/phone/login", handlers.PhoneLogin)
+	r.POST("/customers/phone/register", handlers.PhoneRegister)
+	r.GET("/customers/verify-email", handlers.VerifyEmail)
+	r.POST("/customers/verify-email", handlers.VerifyEmail)
+	r.POST("/customers/verify-email/resend", middleware.AuthMiddleware(), middleware.DenyImpersonation(), handlers.ResendVerificationEmail)
+
+	// ADMIN routes
+	adminRoutes := r.Group("/admin")
+	adminRoutes.Use(middleware.AuthMiddleware(), middleware.RequireRole("admin"))
+	{
+		adminRoutes.GET("/audit", handlers.GetAuditLogs)
+		adminRoutes.GET("/impersonations", handlers.GetImpersonatedRequests)
+		adminRoutes.GET("/sessions", handlers.GetAccountSessions)
+		adminRoutes.DELETE("/sessions/:id", handlers.AdminDeleteSession)
+		adminRoutes.POST("/force-logout", handlers.ForceLogout)
+		adminRoutes.GET("/lockouts", handlers.ListLoginLockouts)
+		adminRoutes.POST("/lockouts/unlock", handlers.UnlockLogin)
+		adminRoutes.GET("/invites", handlers.GetInvites)
+		adminRoutes.POST("/invites", handlers.CreateInvite)
+		adminRoutes.DELETE("/invites/:id", handlers.RevokeInvite)
+		adminRoutes.GET("/security-policy", handlers.GetSecurityPolicy)
+		adminRoutes.PUT("/security-policy", handlers.UpdateSecurityPolicy)
+		adminRoutes.GET("/api-keys", handlers.GetAPIKeys)
+		adminRoutes.POST("/api-keys", handlers.CreateAPIKey)
+		adminRoutes.DELETE("/api-keys/:id", handlers.RevokeAPIKey)
+		adminRoutes.GET("/users", handlers.GetUsers)
+		adminRoutes.GET("/users/:id", handlers.GetUser)
+		adminRoutes.POST("/users/:id/disable", handlers.DisableUser)
+		adminRoutes.POST("/users/:id/enable", handlers.EnableUser)
+		adminRoutes.PUT("/users/:id/role", handlers.UpdateUserRole)
+		adminRoutes.POST("/users/:id/reset-password", handlers.ResetUserPassword)
+		adminRoutes.DELETE("/users/:id", handlers.DeleteUser)
+	}
+
+	// Catalog and order management is for staff; customer tokens get 403
+	requireStaff := middleware.RequireRole("admin", "staff")
 
 	// CATEGORY routes
 	r.GET("/categories", handlers.GetCategories)
 	r.GET("/categories/:id", handlers.GetCategory)
-	r.POST("/categories", middleware.AuthMiddleware(), handlers.CreateCategory)
-	r.PUT("/categories/:id", middleware.AuthMiddleware(), handlers.UpdateCategory)
-	r.DELETE("/categories/:id", middleware.AuthMiddleware(), handlers.DeleteCategory)
+	r.POST("/categories", middleware.AuthMiddleware(), requireStaff, handlers.CreateCategory)
+	r.PUT("/categories/:id", middleware.AuthMiddleware(), requireStaff, handlers.UpdateCategory)
+	r.DELETE("/categories/:id", middleware.AuthMiddleware(), requireStaff, handlers.DeleteCategory)
 
 	// PRODUCT routes
 	r.GET("/products", handlers.GetProducts)
 	r.GET("/products/:id", handlers.GetProduct)
-	r.POST("/products", middleware.AuthMiddleware(), handlers.CreateProduct)
-	r.PUT("/products/:id", middleware.AuthMiddleware(), handlers.UpdateProduct)
-	r.DELETE("/products/:id", middleware.AuthMiddleware(), handlers.DeleteProduct)
+	r.POST("/products", middleware.AuthMiddleware(), requireStaff, handlers.CreateProduct)
+	r.PUT("/products/:id", middleware.AuthMiddleware(), requireStaff, handlers.UpdateProduct)
+	r.DELETE("/products/:id", middleware.AuthMiddleware(), requireStaff, handlers.DeleteProduct)
 
-	// CUSTOMER routes
-	r.GET("/customers", handlers.GetCustomers)
-	r.GET("/customers/:id", handlers.GetCustomer)
-	r.POST("/customers", middleware.AuthMiddleware(), handlers.CreateCustomer)
-	r.PUT("/customers/:id", middleware.AuthMiddleware(), handlers.UpdateCustomer)
-	r.DELETE("/customers/:id", middleware.AuthMiddleware(), handlers.DeleteCustomer)
+	// CUSTOMER self-service routes
+	meRoutes := r.Group("/customers/me")
+	meRoutes.Use(middleware.AuthMiddleware(), middleware.RequireRole("customer"))
+	{
+		meRoutes.GET("", handlers.GetMyProfile)
+		meRoutes.GET("/orders", handlers.GetMyOrders)
+	}
+	// ລາຍການທີ່ staff ເຮັດແທນ customer ບໍ່ໄດ້
+	meAccountRoutes := meRoutes.Group("", middleware.DenyImpersonation())
+	{
+		meAccountRoutes.PUT("", handlers.UpdateMyProfile)
+		meAccountRoutes.PUT("/password", handlers.ChangeMyPassword)
+		meAccountRoutes.GET("/export", handlers.ExportMyData)
+		meAccountRoutes.POST("/erase", handlers.EraseMyAccount)
+	}
+
+	// CUSTOMER routes (Staff)
+	r.GET("/customers", middleware.AuthMiddleware(), requireStaff, handlers.GetCustomers)
+	r.GET("/customers/:id", middleware.AuthMiddleware(), requireStaff, handlers.GetCustomer)
+	r.POST("/customers", middleware.AuthMiddleware(), requireStaff, handlers.CreateCustomer)
+	r.PUT("/customers/:id", middleware.AuthMiddleware(), requireStaff, handlers.UpdateCustomer)
+	r.DELETE("/customers/:id", middleware.AuthMiddleware(), requireStaff, handlers.DeleteCustomer)
+	r.POST("/customers/:id/impersonate", middleware.AuthMiddleware(), requireStaff, handlers.ImpersonateCustomer)
 
 	// ORDER routes
 	r.GET("/orders", middleware.AuthMiddleware(), handlers.GetOrders)
 	r.GET("/orders/:id", middleware.AuthMiddleware(), handlers.GetOrder)
 	r.POST("/orders", middleware.AuthMiddleware(), handlers.CreateOrder)
-	r.PUT("/orders/:id/status", middleware.AuthMiddleware(), handlers.UpdateOrderStatus)
-	r.DELETE("/orders/:id", middleware.AuthMiddleware(), handlers.DeleteOrder)
+	r.PUT("/orders/:id/status", middleware.AuthMiddleware(), requireStaff, handlers.UpdateOrderStatus)
+	r.DELETE("/orders/:id", middleware.AuthMiddleware(), requireStaff, handlers.DeleteOrder)
 
 	// CART routes (Customer)
 	cartRoutes := r.Group("/cart")
 	cartRoutes.Use(middleware.AuthMiddleware())
 	{
 		cartRoutes.GET("", handlers.GetCart)
+		cartRoutes.PUT("", handlers.ReplaceCart)
+		cartRoutes.POST("/batch", handlers.BatchCartItems)
+		cartRoutes.POST("/refresh", handlers.RefreshCart)
 		cartRoutes.POST("/items", handlers.AddCartItem)
 		cartRoutes.PUT("/items/:item_id", handlers.UpdateCartItem)
 		cartRoutes.DELETE("/items/:item_id", handlers.DeleteCartItem)
+		cartRoutes.POST("/items/:item_id/save-for-later", handlers.SaveCartItemForLater)
 		cartRoutes.DELETE("", handlers.ClearCart)
 	}
 
-	r.Run(":8081")
+	// WISHLIST routes (Customer)
+	wishlistRoutes := r.Group("/wishlist")
+	wishlistRoutes.Use(middleware.AuthMiddleware())
+	{
+		wishlistRoutes.GET("", handlers.GetSavedItems)
+		wishlistRoutes.POST("/items", handlers.AddSavedItem)
+		wishlistRoutes.DELETE("/items/:item_id", handlers.DeleteSavedItem)
+		wishlistRoutes.POST("/items/:item_id/move-to-cart", handlers.MoveSavedItemToCart)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	serve(ctx, stop, srv, scheduler)
+}
+
+// serve runs srv until ctx is cancelled, then shuts down in order: stop
+// accepting connections and let open requests (e.g. an order transaction)
+// finish, wait for the background jobs and queued notifications, and close
+// the database pool last because all of them use it. All of this shares
+// one SERVER_SHUTDOWN_TIMEOUT, so a stuck job or SMTP server cannot keep
+// the process from exiting.
+func serve(ctx context.Context, stop context.CancelFunc, srv *http.Server, scheduler *jobs.Scheduler) {
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process instead of waiting.
+	stop()
+	log.Println("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Current.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+
+	waitOrGiveUp(shutdownCtx, "background jobs", scheduler.Wait)
+	waitOrGiveUp(shutdownCtx, "queued notifications", notify.Wait)
+
+	if err := database.Close(); err != nil {
+		log.Printf("shutdown: closing database: %v", err)
+	}
+	log.Println("stopped")
+}
+
+// waitOrGiveUp calls wait and returns when it does or when ctx is done,
+// whichever comes first.
+func waitOrGiveUp(ctx context.Context, what string, wait func()) {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("shutdown: gave up waiting for %s: %v", what, ctx.Err())
+	}
+}
+
+// startJobs registers the periodic background jobs on scheduler.
+func startJobs(ctx context.Context, scheduler *jobs.Scheduler) {
+	cartCfg := config.Current.AbandonedCart
+	if cartCfg.Enabled {
+		job := jobs.NewAbandonedCartJob(cartCfg, notify.Default)
+		scheduler.Every(ctx, "abandoned-carts", cartCfg.Interval, job.Run)
+	}
+
+	scheduler.Every(ctx, "purge-expired-tokens", time.Hour, auth.PurgeExpired)
 }
@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"example.com/go-xampp-api/audit"
+	"example.com/go-xampp-api/auth"
 	"example.com/go-xampp-api/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -12,6 +17,12 @@ import (
 // Middleware ສຳລັບກວດສອບ JWT Token
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API key ສຳລັບ POS ແລະ integration (X-API-Key ຫຼື Authorization: ApiKey ...)
+		if apiKey := extractAPIKey(c); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		// ດຶງ token ຈາກ Authorization header
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
@@ -29,13 +40,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// ກວດສອບວ່າໃຊ້ signing method ທີ່ຖືກຕ້ອງ
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return utils.JWTSecret, nil
-		})
+		token, err := utils.ParseToken(tokenString)
 
 		if err != nil || !token.Valid {
 			errorMsg := "Token ບໍ່ຖືກຕ້ອງຫຼືໝົດອາຍຸແລ້ວ"
@@ -50,6 +55,103 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// ກວດສອບວ່າ token ຖືກຖອນ (revoke) ແລ້ວບໍ່
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "Unauthorized",
+					"message": "Token ຮູບແບບເກົ່າ, ກະລຸນາເຂົ້າສູ່ລະບົບໃໝ່",
+				})
+				c.Abort()
+				return
+			}
+
+			userID, _ := claims["user_id"].(float64)
+			role, _ := claims["role"].(string)
+			issuedAt, _ := claims.GetIssuedAt()
+			expiresAt, _ := claims.GetExpirationTime()
+			var iat time.Time
+			if issuedAt != nil {
+				iat = issuedAt.Time
+			}
+
+			sessionID, _ := claims["sid"].(float64)
+			revoked, err := auth.IsRevoked(jti, auth.SubjectTypeForRole(role), uint(userID), uint(sessionID), iat)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "Unauthorized",
+					"message": "Token ຖືກຍົກເລີກແລ້ວ, ກະລຸນາເຂົ້າສູ່ລະບົບໃໝ່",
+				})
+				c.Abort()
+				return
+			}
+
+			// staff ທີ່ຖືກປິດການໃຊ້ງານ ຫຼື ຖືກລຶບ ໃຊ້ token ບໍ່ໄດ້ອີກ
+			if auth.SubjectTypeForRole(role) == auth.SubjectUser {
+				disabled, err := auth.UserDisabled(uint(userID))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					c.Abort()
+					return
+				}
+				if disabled {
+					c.JSON(http.StatusUnauthorized, gin.H{
+						"error":   "Unauthorized",
+						"message": "ບັນຊີນີ້ຖືກປິດການໃຊ້ງານແລ້ວ",
+					})
+					c.Abort()
+					return
+				}
+			}
+
+			// Impersonation token: staff ທີ່ໃຊ້ແທນ customer ຕ້ອງຍັງໃຊ້ງານໄດ້
+			if actor, ok := auth.ActorFromClaims(claims); ok {
+				disabled, err := auth.UserDisabled(actor.UserID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					c.Abort()
+					return
+				}
+				if disabled || !auth.IsStaffRole(actor.Role) || role != "customer" {
+					c.JSON(http.StatusUnauthorized, gin.H{
+						"error":   "Unauthorized",
+						"message": "Token ຖືກຍົກເລີກແລ້ວ, ກະລຸນາເຂົ້າສູ່ລະບົບໃໝ່",
+					})
+					c.Abort()
+					return
+				}
+				c.Set("impersonator_id", actor.UserID)
+				c.Set("impersonator_username", actor.Username)
+				c.Set("impersonator_role", actor.Role)
+				c.Header("X-Impersonated-By", actor.Username)
+			}
+
+			// Restricted tokens (e.g. 2FA enrollment) only work on routes
+			// that allow their purpose.
+			purpose, _ := claims["purpose"].(string)
+			if purpose != "" && purpose != c.GetString("allowed_token_purpose") {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":   "Forbidden",
+					"message": "Token ນີ້ໃຊ້ໄດ້ສະເພາະ " + purpose,
+				})
+				c.Abort()
+				return
+			}
+
+			c.Set("token_id", jti)
+			c.Set("session_id", uint(sessionID))
+			c.Set("token_purpose", purpose)
+			if expiresAt != nil {
+				c.Set("token_expires_at", expiresAt.Time)
+			}
+		}
+
 		// ເອົາຂໍ້ມູນຈາກ token ໃສ່ context
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
 			if userID, ok := claims["user_id"].(float64); ok {
@@ -70,5 +172,95 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		c.Next()
+
+		// ທຸກ request ທີ່ໃຊ້ impersonation token ຖືກບັນທຶກພ້ອມ staff ຕົວຈິງ
+		audit.RecordImpersonatedRequest(c)
+	}
+}
+
+// DenyImpersonation blocks the route for impersonation tokens, for
+// actions only the customer may take, such as changing the password.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("impersonator_id") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "ບໍ່ສາມາດເຮັດລາຍການນີ້ໃນຂະນະໃຊ້ແທນ customer",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AllowTokenPurpose lets restricted tokens with the given purpose claim
+// through the AuthMiddleware that follows it.
+func AllowTokenPurpose(purpose string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("allowed_token_purpose", purpose)
+		c.Next()
+	}
+}
+
+// extractAPIKey returns the API key sent with the request, if any.
+func extractAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	header := c.GetHeader("Authorization")
+	if key, ok := strings.CutPrefix(header, "ApiKey "); ok {
+		return key
+	}
+	if key, ok := strings.CutPrefix(header, "Bearer "+auth.APIKeyPrefix); ok {
+		return auth.APIKeyPrefix + key
+	}
+	return ""
+}
+
+// authenticateAPIKey checks the key and the scope the current route needs.
+// API keys act with the admin role, limited to their scopes.
+func authenticateAPIKey(c *gin.Context, plain string) {
+	key, err := auth.AuthenticateAPIKey(plain)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if !errors.Is(err, auth.ErrInvalidAPIKey) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"error":   "Unauthorized",
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	scope := requiredScope(c)
+	if !auth.HasScope(key, scope) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": fmt.Sprintf("API key ບໍ່ມີສິດ %s", scope),
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("auth_method", "api_key")
+	c.Set("api_key_id", key.ID)
+	c.Set("username", "api-key:"+key.Name)
+	c.Set("role", "admin")
+	c.Next()
+}
+
+// requiredScope derives the scope of the current route: the first path
+// segment and "read" for GET/HEAD or "write" for anything else.
+func requiredScope(c *gin.Context) string {
+	path := strings.TrimPrefix(c.FullPath(), "/")
+	resource, _, _ := strings.Cut(path, "/")
+
+	action := "write"
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		action = "read"
 	}
+	return resource + ":" + action
 }
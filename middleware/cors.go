@@ -1,15 +1,28 @@
 package middleware
 
 import (
+	"strings"
+
+	"example.com/go-xampp-api/config"
 	"github.com/gin-gonic/gin"
 )
 
-// CORSMiddleware handles CORS headers for cross-origin requests
+// CORSMiddleware handles CORS headers for cross-origin requests. Origins
+// come from cors.allowed_origins; "*" allows every origin.
 func CORSMiddleware() gin.HandlerFunc {
+	cfg := config.Current.CORS
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		if origin := allowedOrigin(cfg.AllowedOrigins, c.GetHeader("Origin")); origin != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if len(cfg.AllowedOrigins) != 1 || cfg.AllowedOrigins[0] != "*" {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if cfg.AllowCredentials {
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, X-API-Key, X-Device-Name")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
@@ -21,3 +34,16 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin,
+// or "" when it is not allowed.
+func allowedOrigin(allowed []string, origin string) string {
+	for _, o := range allowed {
+		if o == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
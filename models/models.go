@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Category struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -16,27 +20,63 @@ type Product struct {
 	Image      *string   `json:"image"`
 	CategoryID *uint     `json:"category_id"`                                     // ໃຊ້ pointer ເພື່ອໃຫ້ສາມາດເປັນ null ໄດ້
 	Category   *Category `json:"category,omitempty" gorm:"foreignKey:CategoryID"` // Eager loading
+	Stock      *int      `json:"stock"`                                           // null = stock is not tracked
+	Version    uint      `json:"version" gorm:"not null;default:1"`               // optimistic locking, exposed as ETag
+
+	// Deleted products are kept for the carts, wishlists and orders that
+	// still point at them, and hidden from every query
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// Roles carried in access tokens. Staff users are "admin" or "staff".
+const (
+	RoleAdmin    = "admin"
+	RoleStaff    = "staff"
+	RoleCustomer = "customer"
+)
+
 type User struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	Username  string    `json:"username" gorm:"unique;not null"`
 	Email     string    `json:"email" gorm:"unique;not null"`
 	Password  string    `json:"-" gorm:"not null"` // "-" ບໍ່ສົ່ງ password ອອກໄປໃນ JSON
+	Role      string    `json:"role" gorm:"size:20;not null;default:admin"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// TOTP two-factor authentication
+	TOTPSecret        string     `json:"-" gorm:"size:64"`
+	TOTPPendingSecret string     `json:"-" gorm:"size:64"` // set during enrollment until the first code is confirmed
+	TOTPLastStep      int64      `json:"-"`                // last accepted time step, so a code cannot be replayed
+	TOTPEnabledAt     *time.Time `json:"totp_enabled_at"`
+
+	// Identity at the OpenID Connect provider, set for users who log in
+	// through it
+	OIDCIssuer  *string `json:"oidc_issuer,omitempty" gorm:"size:255;uniqueIndex:idx_users_oidc"`
+	OIDCSubject *string `json:"-" gorm:"size:255;uniqueIndex:idx_users_oidc"`
+
+	// Set by an admin; disabled users cannot log in and their tokens stop
+	// working
+	DisabledAt *time.Time `json:"disabled_at"`
 }
 
 type Customer struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"not null"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"` // "-" ບໍ່ສົ່ງ password ອອກໄປໃນ JSON
-	Phone     string    `json:"phone"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"created_at"`
-	Orders    []Order   `json:"orders,omitempty" gorm:"foreignKey:CustomerID"`
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Name            string     `json:"name" gorm:"not null"`
+	Email           *string    `json:"email" gorm:"unique"` // nil for customers who registered with a phone number
+	Password        string     `json:"-" gorm:"not null"`   // "-" ບໍ່ສົ່ງ password ອອກໄປໃນ JSON
+	Phone           string     `json:"phone"`
+	LoginPhone      *string    `json:"login_phone" gorm:"size:20;unique"` // E.164, for login with SMS codes
+	Address         string     `json:"address"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	ErasedAt        *time.Time `json:"erased_at,omitempty"` // personal data was erased on request
+	Version         uint       `json:"version" gorm:"not null;default:1"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Orders          []Order    `json:"orders,omitempty" gorm:"foreignKey:CustomerID"`
 }
 
+// ErasedValue replaces personal data of customers who asked for erasure.
+const ErasedValue = "[erased]"
+
 type Order struct {
 	ID              uint        `json:"id" gorm:"primaryKey"`
 	CustomerID      uint        `json:"customer_id" gorm:"not null"`
@@ -45,6 +85,7 @@ type Order struct {
 	TotalAmount     int         `json:"total_amount"`
 	ShippingAddress string      `json:"shipping_address"` // ທີ່ຢູ່ຈັດສົ່ງ
 	OrderItems      []OrderItem `json:"order_items,omitempty" gorm:"foreignKey:OrderID"`
+	Version         uint        `json:"version" gorm:"not null;default:1"`
 	CreatedAt       time.Time   `json:"created_at"`
 	UpdatedAt       time.Time   `json:"updated_at"`
 }
@@ -65,30 +106,324 @@ type Cart struct {
 	CustomerID  uint       `json:"customer_id" gorm:"uniqueIndex"`
 	Items       []CartItem `json:"items,omitempty" gorm:"foreignKey:CartID"`
 	TotalAmount int        `json:"total_amount"`
+	HasDrift    bool       `json:"has_drift" gorm:"-"` // true when any item no longer matches its product
+	Version     uint       `json:"version" gorm:"not null;default:1"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 type CartItem struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	CartID       uint       `json:"cart_id" gorm:"index"`
+	Cart         *Cart      `json:"-" gorm:"foreignKey:CartID"`
+	ProductID    uint       `json:"product_id" gorm:"not null"`
+	Product      *Product   `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductName  string     `json:"product_name"`
+	ProductImage *string    `json:"product_image"`
+	UnitPrice    int        `json:"unit_price"`
+	Quantity     int        `json:"quantity"`
+	Subtotal     int        `json:"subtotal" gorm:"-"`
+	Drift        *ItemDrift `json:"drift,omitempty" gorm:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ItemDrift describes how a cart or saved item differs from the current
+// product.
+type ItemDrift struct {
+	PriceChanged      bool `json:"price_changed"`
+	CurrentPrice      *int `json:"current_price,omitempty"`
+	ProductRemoved    bool `json:"product_removed"`
+	InsufficientStock bool `json:"insufficient_stock"`
+	AvailableStock    *int `json:"available_stock,omitempty"`
+}
+
+// SavedItem is a product a customer parked for later (wishlist).
+type SavedItem struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	CustomerID uint       `json:"customer_id" gorm:"uniqueIndex:idx_saved_items_customer_product"`
+	ProductID  uint       `json:"product_id" gorm:"uniqueIndex:idx_saved_items_customer_product"`
+	Product    *Product   `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	SavedPrice int        `json:"saved_price"` // ລາຄາໃນຕອນທີ່ບັນທຶກ
+	Quantity   int        `json:"quantity"`    // quantity restored when moved to the cart
+	Drift      *ItemDrift `json:"drift,omitempty" gorm:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// RefreshToken is a server-side refresh token. Only the SHA-256 hash of the
+// token is stored. Tokens issued from the same login share a FamilyID so a
+// reused (already rotated) token can revoke the whole family.
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TokenHash    string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	FamilyID     string     `json:"family_id" gorm:"size:64;index"`
+	SubjectType  string     `json:"subject_type" gorm:"size:20;index:idx_refresh_tokens_subject"` // user, customer
+	SubjectID    uint       `json:"subject_id" gorm:"index:idx_refresh_tokens_subject"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Session is one login of a user or customer on a device. It lives as long
+// as its refresh token family; revoking it stops its access tokens too.
+type Session struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	FamilyID    string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	SubjectType string     `json:"subject_type" gorm:"size:20;index:idx_sessions_subject"` // user, customer
+	SubjectID   uint       `json:"subject_id" gorm:"index:idx_sessions_subject"`
+	Device      string     `json:"device"`
+	IP          string     `json:"ip" gorm:"size:45"`
+	UserAgent   string     `json:"user_agent" gorm:"size:512"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// RevokedToken lists access tokens (by jti) that must be rejected before
+// they expire.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// SubjectRevocation invalidates every token of an account issued before
+// RevokedAt, e.g. after logout from all devices or a password change.
+type SubjectRevocation struct {
+	SubjectType string    `gorm:"primaryKey;size:20"`
+	SubjectID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	RevokedAt   time.Time `gorm:"not null"`
+}
+
+// Action token purposes
+const (
+	ActionPasswordReset = "password_reset"
+	ActionVerifyEmail   = "verify_email"
+	ActionLogin2FA      = "login_2fa"
+)
+
+// ActionToken is a single-use, expiring token sent to a user by email, e.g.
+// for a password reset or email verification. Only the SHA-256 hash is stored.
+type ActionToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Purpose     string     `json:"purpose" gorm:"size:32;index:idx_action_tokens_subject"`
+	SubjectType string     `json:"subject_type" gorm:"size:20;index:idx_action_tokens_subject"`
+	SubjectID   uint       `json:"subject_id" gorm:"index:idx_action_tokens_subject"`
+	TokenHash   string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// LoginThrottle counts recent failed logins for one key: an account
+// ("user:<username>", "customer:<email>") or a client IP ("ip:<address>").
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"primaryKey;size:191"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// APIKey lets POS and integration clients call the API without a staff
+// login. Only the SHA-256 hash of the key is stored; Prefix is the public
+// part used to look the key up.
+type APIKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"not null"`
+	Prefix      string     `json:"prefix" gorm:"size:16;uniqueIndex;not null"`
+	KeyHash     string     `json:"-" gorm:"size:64;not null"`
+	Scopes      string     `json:"scopes"` // comma separated, e.g. "products:read,orders:write"
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedByID uint       `json:"created_by_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the hash is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserInvite lets one person register a staff account with the given role.
+// Only the hash of the invite token is stored.
+type UserInvite struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Email       string     `json:"email"` // empty = anyone holding the token
+	Role        string     `json:"role" gorm:"size:20;not null"`
+	TokenHash   string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	UsedByID    *uint      `json:"used_by_id"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedByID uint       `json:"created_by_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SecurityPolicy holds security settings admins can change at runtime.
+// There is a single row with ID 1.
+type SecurityPolicy struct {
+	ID              uint      `json:"-" gorm:"primaryKey"`
+	RequireStaff2FA bool      `json:"require_staff_2fa" gorm:"not null;default:false"`
+	UpdatedByID     uint      `json:"updated_by_id"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// OIDCLoginState is a pending OpenID Connect login between the redirect to
+// the identity provider and its callback. Only the hash of the state is
+// stored.
+type OIDCLoginState struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
-	CartID       uint      `json:"cart_id" gorm:"index"`
-	Cart         *Cart     `json:"-" gorm:"foreignKey:CartID"`
-	ProductID    uint      `json:"product_id" gorm:"not null"`
-	Product      *Product  `json:"product,omitempty" gorm:"foreignKey:ProductID"`
-	ProductName  string    `json:"product_name"`
-	ProductImage *string   `json:"product_image"`
-	UnitPrice    int       `json:"unit_price"`
-	Quantity     int       `json:"quantity"`
-	Subtotal     int       `json:"subtotal" gorm:"-"`
+	StateHash    string    `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Nonce        string    `json:"-" gorm:"size:64;not null"`
+	CodeVerifier string    `json:"-" gorm:"size:128;not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
 	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PhoneOTP is a one-time code sent by SMS to register or log in with a
+// phone number. Only the hash of the code is stored.
+type PhoneOTP struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Phone     string     `json:"phone" gorm:"size:20;index;not null"` // E.164
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	Attempts  int        `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordHistory keeps the hashes of earlier passwords of a user or
+// customer so they cannot be chosen again.
+type PasswordHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	SubjectType  string    `json:"subject_type" gorm:"size:20;index:idx_password_histories_subject"` // user, customer
+	SubjectID    uint      `json:"subject_id" gorm:"index:idx_password_histories_subject"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AuditLog is one privileged change made through the API. Before and After
+// hold the changed fields only (the full row for creates and deletes).
+type AuditLog struct {
+	ID         uint                   `json:"id" gorm:"primaryKey"`
+	ActorType  string                 `json:"actor_type" gorm:"size:20;index:idx_audit_actor"` // user, api_key or customer
+	ActorID    uint                   `json:"actor_id" gorm:"index:idx_audit_actor"`
+	ActorName  string                 `json:"actor_name"`
+	Role       string                 `json:"role" gorm:"size:20"`
+	IP         string                 `json:"ip" gorm:"size:45"`
+	Action     string                 `json:"action" gorm:"size:20;index"`
+	EntityType string                 `json:"entity_type" gorm:"size:30;index:idx_audit_entity"`
+	EntityID   uint                   `json:"entity_id" gorm:"index:idx_audit_entity"`
+	Before     map[string]interface{} `json:"before" gorm:"serializer:json;type:text"`
+	After      map[string]interface{} `json:"after" gorm:"serializer:json;type:text"`
+	CreatedAt  time.Time              `json:"created_at" gorm:"index"`
+}
+
+// ImpersonatedRequest is one request a staff user made with an
+// impersonation token, i.e. while acting as a customer.
+type ImpersonatedRequest struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TokenID    string    `json:"token_id" gorm:"size:32;index"` // jti of the impersonation token
+	ActorID    uint      `json:"actor_id" gorm:"index"`         // the staff user
+	ActorName  string    `json:"actor_name"`
+	ActorRole  string    `json:"actor_role" gorm:"size:20"`
+	CustomerID uint      `json:"customer_id" gorm:"index"`
+	Method     string    `json:"method" gorm:"size:10"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	IP         string    `json:"ip" gorm:"size:45"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// New rows start at version 1 so the first ETag is stable before a reload.
+func (p *Product) BeforeCreate(tx *gorm.DB) error {
+	if p.Version == 0 {
+		p.Version = 1
+	}
+	return nil
+}
+
+func (c *Customer) BeforeCreate(tx *gorm.DB) error {
+	if c.Version == 0 {
+		c.Version = 1
+	}
+	return nil
+}
+
+// EmailAddress returns the email, or "" for customers without one.
+func (c Customer) EmailAddress() string {
+	if c.Email == nil {
+		return ""
+	}
+	return *c.Email
+}
+
+// LoginName identifies the customer in tokens: the email, or the phone
+// number for customers who registered with one.
+func (c Customer) LoginName() string {
+	if c.Email != nil {
+		return *c.Email
+	}
+	if c.LoginPhone != nil {
+		return *c.LoginPhone
+	}
+	return ""
+}
+
+func (o *Order) BeforeCreate(tx *gorm.DB) error {
+	if o.Version == 0 {
+		o.Version = 1
+	}
+	return nil
+}
+
+func (c *Cart) BeforeCreate(tx *gorm.DB) error {
+	if c.Version == 0 {
+		c.Version = 1
+	}
+	return nil
+}
+
+// Cart reminder statuses
+const (
+	CartReminderQueued = "queued"
+	CartReminderSent   = "sent"
+	CartReminderFailed = "failed"
+)
+
+// CartReminder is an abandoned cart notification and its outcome.
+type CartReminder struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	CartID        uint       `json:"cart_id" gorm:"index"`
+	CustomerID    uint       `json:"customer_id" gorm:"index"`
+	CartUpdatedAt time.Time  `json:"cart_updated_at"` // cart state the reminder was queued for
+	CartTotal     int        `json:"cart_total"`
+	Status        string     `json:"status" gorm:"index;default:'queued'"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at"`
+	ConvertedAt   *time.Time `json:"converted_at"`
+	OrderID       *uint      `json:"order_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 // Struct ສຳລັບຮັບຂໍ້ມູນການລົງທະບຽນ
 type RegisterInput struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	InviteToken string `json:"invite_token" binding:"required"`
+	Username    string `json:"username" binding:"required"`
+	Email       string `json:"email" binding:"required,email"`
+	Password    string `json:"password" binding:"required,min=6"`
 }
 
 // Struct ສຳລັບຮັບຂໍ້ມູນການເຂົ້າສູ່ລະບົບ
@@ -144,6 +479,28 @@ type CustomerLoginInput struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// Struct ສຳລັບແກ້ໄຂ customer; field ທີ່ບໍ່ສົ່ງມາຈະບໍ່ປ່ຽນ
+type UpdateCustomerInput struct {
+	Name     *string `json:"name"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+	Password *string `json:"password" binding:"omitempty,min=6"`
+	Phone    *string `json:"phone"`
+	Address  *string `json:"address"`
+}
+
+// Struct ສຳລັບ customer ແກ້ໄຂຂໍ້ມູນຕົນເອງ (ປ່ຽນ password ຜ່ານ /customers/me/password)
+type UpdateProfileInput struct {
+	Name    *string `json:"name"`
+	Email   *string `json:"email" binding:"omitempty,email"`
+	Phone   *string `json:"phone"`
+	Address *string `json:"address"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
 type AddCartItemInput struct {
 	ProductID uint `json:"product_id" binding:"required"`
 	Quantity  int  `json:"quantity" binding:"required,min=1"`
@@ -152,3 +509,143 @@ type AddCartItemInput struct {
 type UpdateCartItemInput struct {
 	Quantity int `json:"quantity" binding:"required,min=1"`
 }
+
+type SaveItemInput struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"omitempty,min=1"`
+}
+
+// Struct ສຳລັບແທນທີ່ລາຍການທັງໝົດໃນ cart (PUT /cart). Items are validated
+// one by one so the response can report a result per item.
+type ReplaceCartInput struct {
+	Items []CartItemQuantityInput `json:"items" binding:"required"`
+}
+
+type CartItemQuantityInput struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+// Struct ສຳລັບ batch operations ໃນ cart (POST /cart/batch)
+type CartBatchInput struct {
+	Operations []CartBatchOperation `json:"operations" binding:"required,min=1"`
+}
+
+// CartBatchOperation is one add, update or remove. Update and remove
+// address the item by item_id or by product_id.
+type CartBatchOperation struct {
+	Op        string `json:"op"` // add, update, remove
+	ItemID    uint   `json:"item_id"`
+	ProductID uint   `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Struct ສຳລັບ refresh token ແລະ logout
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"` // logout from every device
+}
+
+// Struct ສຳລັບຂໍ reset password
+type PasswordResetRequestInput struct {
+	Email       string `json:"email" binding:"required,email"`
+	AccountType string `json:"account_type" binding:"omitempty,oneof=customer user"` // default customer
+}
+
+// Struct ສຳລັບຕັ້ງ password ໃໝ່ດ້ວຍ reset token
+type PasswordResetConfirmInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// Struct ສຳລັບຢືນຢັນ email
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Struct ສຳລັບປົດລັອກການເຂົ້າສູ່ລະບົບ. Give either key, ip, or
+// account_type with identifier (username or email).
+type UnlockLoginInput struct {
+	Key         string `json:"key"`
+	IP          string `json:"ip"`
+	AccountType string `json:"account_type" binding:"omitempty,oneof=user customer"`
+	Identifier  string `json:"identifier"`
+}
+
+// Struct ສຳລັບສ້າງ API key
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"` // null = never expires
+}
+
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type SecurityPolicyInput struct {
+	RequireStaff2FA *bool `json:"require_staff_2fa" binding:"required"`
+}
+
+type CreateInviteInput struct {
+	Role           string `json:"role" binding:"required,oneof=admin staff"`
+	Email          string `json:"email" binding:"omitempty,email"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+type ForceLogoutInput struct {
+	AccountType string `json:"account_type" binding:"required,oneof=user customer"`
+	AccountID   uint   `json:"account_id" binding:"required"`
+}
+
+// PhoneCodeInput asks for a one-time code by SMS.
+type PhoneCodeInput struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// PhoneLoginInput logs a customer in with the code sent by SMS.
+type PhoneLoginInput struct {
+	Phone string `json:"phone" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// PhoneRegisterInput creates a customer who logs in with SMS codes.
+type PhoneRegisterInput struct {
+	Phone   string `json:"phone" binding:"required"`
+	Code    string `json:"code" binding:"required"`
+	Name    string `json:"name" binding:"required"`
+	Address string `json:"address"`
+}
+
+// EraseAccountInput confirms a customer's request to erase their data.
+// Customers who log in with a password must enter it.
+type EraseAccountInput struct {
+	Password string `json:"password"`
+	Confirm  bool   `json:"confirm" binding:"required"`
+}
+
+// UpdateUserRoleInput changes the role of a staff user.
+type UpdateUserRoleInput struct {
+	Role string `json:"role" binding:"required,oneof=admin staff"`
+}
+
+// ImpersonateCustomerInput starts an impersonation. The reason is kept in
+// the audit log.
+type ImpersonateCustomerInput struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/go-xampp-api/config"
+)
+
+// Message is a notification addressed to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers notifications. Implementations must be safe for
+// concurrent use.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender writes every message to the standard logger instead of
+// delivering it. Useful for local development.
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, msg Message) error {
+	log.Printf("notify: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender stores every message as a text file in Dir (a local outbox).
+type FileSender struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+func (s FileSender) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d_%s.txt", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	content := "To: " + msg.To + "\nSubject: " + msg.Subject + "\n\n" + msg.Body + "\n"
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0644)
+}
+
+// SMTPSender delivers messages through an SMTP server using PLAIN auth
+// when a username is set.
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(_ context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	content := "From: " + s.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(content))
+}
+
+// Default is the sender used by request handlers. main replaces it with the
+// sender selected by FromConfig.
+var Default Sender = LogSender{}
+
+var pending sync.WaitGroup
+
+// SendAsync delivers msg through Default without blocking the caller, so
+// response times do not reveal whether a message was sent. Failures are
+// logged.
+func SendAsync(msg Message) {
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		if err := Default.Send(context.Background(), msg); err != nil {
+			log.Printf("notify: send to %s failed: %v", msg.To, err)
+		}
+	}()
+}
+
+// Wait blocks until every message queued with SendAsync or SendSMSAsync
+// was handled.
+func Wait() {
+	pending.Wait()
+}
+
+// FromConfig builds the Sender selected by cfg.Sender (log, file or smtp).
+func FromConfig(cfg config.Notify) (Sender, error) {
+	switch cfg.Sender {
+	case "log":
+		return LogSender{}, nil
+	case "file":
+		return FileSender{Dir: cfg.OutboxDir}, nil
+	case "smtp":
+		return SMTPSender{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFY_SENDER %q", cfg.Sender)
+	}
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"example.com/go-xampp-api/config"
+)
+
+// SMS is a text message to a single phone number in E.164 format.
+type SMS struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages. Implementations wrap an SMS gateway
+// and must be safe for concurrent use.
+type SMSSender interface {
+	SendSMS(ctx context.Context, msg SMS) error
+}
+
+// LogSMSSender writes every text message to the standard logger instead of
+// delivering it. Useful for local development; it logs one-time codes, so
+// never use it in production.
+type LogSMSSender struct{}
+
+func (LogSMSSender) SendSMS(_ context.Context, msg SMS) error {
+	log.Printf("notify: sms to=%s\n%s", msg.To, msg.Body)
+	return nil
+}
+
+// DefaultSMS is the SMS sender used by request handlers. main replaces it
+// with the sender selected by SMSFromConfig.
+var DefaultSMS SMSSender = LogSMSSender{}
+
+// SendSMSAsync delivers msg through DefaultSMS without blocking the caller.
+// Failures are logged.
+func SendSMSAsync(msg SMS) {
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		if err := DefaultSMS.SendSMS(context.Background(), msg); err != nil {
+			log.Printf("notify: sms to %s failed: %v", msg.To, err)
+		}
+	}()
+}
+
+// SMSFromConfig builds the SMSSender selected by cfg.SMSSender. Only "log"
+// is built in; a gateway is added by implementing SMSSender.
+func SMSFromConfig(cfg config.Notify) (SMSSender, error) {
+	switch cfg.SMSSender {
+	case "log":
+		return LogSMSSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS_SENDER %q", cfg.SMSSender)
+	}
+}
@@ -0,0 +1,191 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockKeyID = "mock-key"
+
+// MockProvider is a minimal identity provider for local development. It
+// approves every authorization request without a login page and issues
+// ID tokens with fixed claims. Never expose it outside a developer
+// machine.
+type MockProvider struct {
+	issuer string
+	claims map[string]interface{}
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	loginHint   string
+	challenge   string
+	expiresAt   time.Time
+}
+
+// NewMockProvider returns a provider for issuer (its own base URL) that
+// puts claims into every ID token. A ?login_hint= on the authorization
+// request replaces the sub, email and preferred_username claims.
+func NewMockProvider(issuer string, claims map[string]interface{}) (*MockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MockProvider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		claims: claims,
+		key:    key,
+		codes:  map[string]mockCode{},
+	}, nil
+}
+
+func (m *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                m.issuer,
+			"authorization_endpoint":                m.issuer + "/authorize",
+			"token_endpoint":                        m.issuer + "/token",
+			"jwks_uri":                              m.issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/jwks":
+		b64 := base64.RawURLEncoding.EncodeToString
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   b64(m.key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "only response_type=code with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	m.mu.Lock()
+	m.codes[code] = mockCode{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		loginHint:   q.Get("login_hint"),
+		challenge:   q.Get("code_challenge"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	m.mu.Unlock()
+
+	back := redirectURI.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	verifier := r.PostForm.Get("code_verifier")
+	if !ok || time.Now().After(code.expiresAt) ||
+		r.PostForm.Get("grant_type") != "authorization_code" ||
+		code.clientID != clientID ||
+		code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		subtle.ConstantTimeCompare([]byte(CodeChallenge(verifier)), []byte(code.challenge)) != 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	if loginHint := code.loginHint; loginHint != "" {
+		claims["sub"] = loginHint
+		claims["preferred_username"], _, _ = strings.Cut(loginHint, "@")
+		if strings.Contains(loginHint, "@") {
+			claims["email"] = loginHint
+		}
+	}
+	claims["iss"] = m.issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mockKeyID
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
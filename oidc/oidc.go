@@ -0,0 +1,399 @@
+// Package oidc implements the parts of OpenID Connect the API needs to log
+// staff in through the company identity provider: discovery, the
+// authorization code flow with PKCE and ID token verification.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval limits how often an unknown kid triggers a new
+// download of the provider's keys.
+const jwksRefreshInterval = time.Minute
+
+// ErrInvalidIDToken is returned when the ID token fails verification.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Config describes the client registration at the identity provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the verified ID token claims used for login.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Raw               jwt.MapClaims
+}
+
+// Provider talks to one identity provider. Its discovery document and
+// keys are loaded on first use and cached.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *discovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider returns a provider for config. No request is made until the
+// first login.
+func NewProvider(config Config) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636).
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 code challenge of a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to send the browser to.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the
+// verified claims of the ID token. nonce must be the value sent in
+// AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return Claims{}, fmt.Errorf("token endpoint: %w", err)
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return Claims{}, fmt.Errorf("token endpoint: %d %s %s", status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return Claims{}, errors.New("token endpoint: no id_token in response")
+	}
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce
+// of an ID token.
+func (p *Provider) VerifyIDToken(ctx context.Context, idToken, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return Claims{}, fmt.Errorf("%w: azp mismatch", ErrInvalidIDToken)
+		}
+	}
+
+	result := Claims{Raw: claims}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string: // some providers send "true"
+		result.EmailVerified = v == "true"
+	}
+	if result.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no sub claim", ErrInvalidIDToken)
+	}
+	return result, nil
+}
+
+// StringValues returns a claim as a list of strings. A single string and
+// a space separated string both count.
+func (c Claims) StringValues(name string) []string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var d discovery
+	status, err := p.doJSON(req, &d)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery: status %d", status)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", d.Issuer, p.config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the provider key with the given kid, downloading the key set
+// again when the kid is unknown (the provider may have rotated).
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.lookupKey(kid); ok {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, d.JWKSURI)
+	p.keysFetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if k, ok := p.lookupKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey finds a key by kid. Tokens without a kid are accepted when the
+// provider publishes a single key.
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("jwks: status %d", status)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			continue // skip key types we cannot use
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func parseJWK(jwk jsonWebKey) (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := b64(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := b64(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := b64(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported OKP key %q", jwk.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func (p *Provider) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, err := NewMockProvider("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	mock.issuer = server.URL
+
+	provider := NewProvider(Config{Issuer: server.URL, ClientID: "rice-api"})
+	now := time.Now()
+
+	// valid returns the claims of a token the provider accepts.
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   server.URL,
+			"aud":   "rice-api",
+			"sub":   "user-1",
+			"email": "staff@example.com",
+			"nonce": "nonce-1",
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+		}
+	}
+	with := func(changes jwt.MapClaims) jwt.MapClaims {
+		claims := valid()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	signRS256 := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = mockKeyID
+		signed, err := token.SignedString(mock.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", signRS256(valid()), "nonce-1", false},
+		{"issuer with another path", signRS256(with(jwt.MapClaims{"iss": server.URL + "/other"})), "nonce-1", true},
+		{"wrong issuer", signRS256(with(jwt.MapClaims{"iss": "https://evil.example.com"})), "nonce-1", true},
+		{"wrong audience", signRS256(with(jwt.MapClaims{"aud": "other-client"})), "nonce-1", true},
+		{"audience list with azp", signRS256(with(jwt.MapClaims{"aud": []string{"rice-api", "other"}, "azp": "rice-api"})), "nonce-1", false},
+		{"audience list without azp", signRS256(with(jwt.MapClaims{"aud": []string{"rice-api", "other"}})), "nonce-1", true},
+		{"wrong nonce", signRS256(valid()), "nonce-2", true},
+		{"missing nonce", signRS256(with(jwt.MapClaims{"nonce": nil})), "", true},
+		{"expired", signRS256(with(jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()})), "nonce-1", true},
+		{"no expiry", signRS256(with(jwt.MapClaims{"exp": nil})), "nonce-1", true},
+		{"no subject", signRS256(with(jwt.MapClaims{"sub": nil})), "nonce-1", true},
+		{"unknown key id", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, valid())
+			token.Header["kid"] = "other-key"
+			signed, _ := token.SignedString(mock.key)
+			return signed
+		}(), "nonce-1", true},
+		{"alg HS256 with the public key as secret", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, valid())
+			token.Header["kid"] = mockKeyID
+			signed, _ := token.SignedString(mock.key.PublicKey.N.Bytes())
+			return signed
+		}(), "nonce-1", true},
+		{"alg none", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, valid())
+			token.Header["kid"] = mockKeyID
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}(), "nonce-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIDToken) {
+					t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "staff@example.com" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
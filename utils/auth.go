@@ -1,43 +1,60 @@
 package utils
 
 import (
-	"os"
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
+	"example.com/go-xampp-api/config"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// JWT secret key (ໃນໂປຣເຈັກຈິງຄວນເກັບໃນ environment variable)
-var JWTSecret = []byte(getenv("JWT_SECRET", "my-secret-key-change-in-production"))
-
-// Hash password ດ້ວຍ bcrypt
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+// AccessToken is a signed JWT together with the claims needed to revoke it.
+type AccessToken struct {
+	Token     string
+	ID        string // jti claim
+	ExpiresAt time.Time
 }
 
-// ກວດສອບວ່າ password ຖືກຕ້ອງບໍ່
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// ສ້າງ JWT access token ອາຍຸສັ້ນ
+func GenerateToken(userID uint, username string, role string) (AccessToken, error) {
+	return GenerateTokenWithClaims(userID, username, role, config.Current.JWT.AccessTTL, nil)
 }
 
-// ສ້າງ JWT token
-func GenerateToken(userID uint, username string, role string) (string, error) {
+// GenerateTokenWithClaims creates a token with a custom lifetime and extra
+// claims. Every token gets a unique jti so it can be revoked.
+func GenerateTokenWithClaims(userID uint, username string, role string, ttl time.Duration, extra jwt.MapClaims) (AccessToken, error) {
+	jti, err := RandomHex(16)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
 	claims := jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
-		"role":     role, // "admin" or "customer"
-		"exp":      time.Now().Add(time.Hour * 24 * 7).Unix(), // Token ໝົດອາຍຸໃນ 7 ວັນ
+		"role":     role, // "admin", "staff" or "customer"
+		"jti":      jti,
+		"iat":      now.Unix(),
+		"exp":      expiresAt.Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	signed, err := signClaims(claims)
+	if err != nil {
+		return AccessToken{}, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JWTSecret)
+	return AccessToken{Token: signed, ID: jti, ExpiresAt: expiresAt}, nil
 }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// RandomHex returns n random bytes encoded as hex.
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return def
+	return hex.EncodeToString(b), nil
 }
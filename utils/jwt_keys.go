@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"example.com/go-xampp-api/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// verificationKey is a public key that access tokens may be signed with.
+type verificationKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// keySet holds the key new tokens are signed with and every key tokens are
+// still accepted from. With HS256 the shared secret is used for both.
+type keySet struct {
+	method     jwt.SigningMethod
+	signingKey crypto.PrivateKey
+	signingKID string
+	verify     map[string]verificationKey
+}
+
+// jwtKeys starts as HS256 so tokens work before InitJWTKeys runs.
+var jwtKeys = &keySet{method: jwt.SigningMethodHS256}
+
+// InitJWTKeys loads the signing keys of the jwt settings:
+//
+//	alg                HS256 (default), RS256 or EdDSA
+//	signing_key_file   PEM private key for RS256/EdDSA
+//	key_id             kid of the signing key (default: JWK thumbprint)
+//	verify_key_files   PEM public keys still accepted after a rotation,
+//	                   optionally as kid=path
+//
+// The secret and the required files are checked by config.Validate.
+func InitJWTKeys() error {
+	cfg := config.Current.JWT
+	alg := strings.ToUpper(cfg.Alg)
+	switch alg {
+	case "HS256":
+		jwtKeys = &keySet{method: jwt.SigningMethodHS256}
+		return nil
+	case "RS256", "EDDSA":
+	default:
+		return fmt.Errorf("unsupported JWT_ALG %q", alg)
+	}
+
+	private, err := loadPrivateKey(cfg.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("JWT_SIGNING_KEY_FILE: %w", err)
+	}
+
+	var method jwt.SigningMethod
+	var public crypto.PublicKey
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		method, public = jwt.SigningMethodRS256, &k.PublicKey
+	case ed25519.PrivateKey:
+		method, public = jwt.SigningMethodEdDSA, k.Public()
+	}
+	if method.Alg() != jwtAlgName(alg) {
+		return fmt.Errorf("JWT_SIGNING_KEY_FILE holds a %s key, JWT_ALG is %s", method.Alg(), alg)
+	}
+
+	keys := &keySet{
+		method:     method,
+		signingKey: private,
+		verify:     map[string]verificationKey{},
+	}
+	keys.signingKID = cfg.KeyID
+	if keys.signingKID == "" {
+		if keys.signingKID, err = thumbprint(public); err != nil {
+			return err
+		}
+	}
+	keys.verify[keys.signingKID] = verificationKey{kid: keys.signingKID, method: method, key: public}
+
+	for _, entry := range cfg.VerifyKeyFiles {
+		kid, file, ok := strings.Cut(entry, "=")
+		if !ok {
+			kid, file = "", entry
+		}
+		vk, err := loadVerificationKey(kid, file)
+		if err != nil {
+			return fmt.Errorf("JWT_VERIFY_KEY_FILES %s: %w", file, err)
+		}
+		if _, dup := keys.verify[vk.kid]; dup {
+			return fmt.Errorf("JWT_VERIFY_KEY_FILES %s: duplicate kid %q", file, vk.kid)
+		}
+		keys.verify[vk.kid] = vk
+	}
+
+	jwtKeys = keys
+	return nil
+}
+
+// signClaims signs claims with the active key and sets its kid header.
+func signClaims(claims jwt.MapClaims) (string, error) {
+	keys := jwtKeys
+	token := jwt.NewWithClaims(keys.method, claims)
+	if keys.signingKey == nil {
+		return token.SignedString([]byte(config.Current.JWT.Secret))
+	}
+	token.Header["kid"] = keys.signingKID
+	return token.SignedString(keys.signingKey)
+}
+
+// ParseToken verifies an access token against the configured keys. Tokens
+// are matched to a verification key by their kid header.
+func ParseToken(tokenString string) (*jwt.Token, error) {
+	keys := jwtKeys
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if keys.signingKey == nil {
+			// ກວດສອບວ່າໃຊ້ signing method ທີ່ຖືກຕ້ອງ
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return []byte(config.Current.JWT.Secret), nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		vk, ok := keys.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != vk.method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return vk.key, nil
+	}, jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public verification keys. It is empty with HS256, whose
+// secret must never be published.
+func JWKS() []JWK {
+	keys := jwtKeys
+	set := make([]JWK, 0, len(keys.verify))
+	for _, vk := range keys.verify {
+		jwk := publicJWK(vk.key)
+		jwk.Kid = vk.kid
+		jwk.Use = "sig"
+		jwk.Alg = vk.method.Alg()
+		set = append(set, jwk)
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Kid < set[j].Kid })
+	return set
+}
+
+func jwtAlgName(alg string) string {
+	if alg == "EDDSA" {
+		return "EdDSA"
+	}
+	return alg
+}
+
+func loadVerificationKey(kid, path string) (verificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return verificationKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return verificationKey{}, errors.New("no PEM data found")
+	}
+
+	var public crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return verificationKey{}, err
+	}
+
+	vk := verificationKey{kid: kid, key: public}
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return verificationKey{}, errors.New("RSA keys must be at least 2048 bits")
+		}
+		vk.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		vk.method = jwt.SigningMethodEdDSA
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %T", public)
+	}
+	if vk.kid == "" {
+		if vk.kid, err = thumbprint(public); err != nil {
+			return verificationKey{}, err
+		}
+	}
+	return vk, nil
+}
+
+func loadPrivateKey(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var private crypto.PrivateKey
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: b64(k.N.Bytes()), E: b64(big.NewInt(int64(k.E)).Bytes())}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: b64(k)}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the default kid.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk := publicJWK(public)
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		// Members in lexicographic order, as required by RFC 7638.
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", public)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"example.com/go-xampp-api/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	// bcrypt only looks at the first 72 bytes and rejects longer input.
+	bcryptMaxPasswordBytes = 72
+	maxPasswordBytes       = 256
+)
+
+// ErrWeakPassword is wrapped by every password policy violation.
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// breachedPasswords holds the upper-case SHA-1 hex of every password in
+// PASSWORD_BREACHED_LIST_FILE.
+var breachedPasswords map[string]struct{}
+
+// InitPasswordPolicy loads the breached password list. The hasher settings
+// are checked by config.Validate. The list file has one entry per line:
+// either a plain password or a SHA-1 hash in the "HASH" or "HASH:count"
+// format of the Have I Been Pwned downloads. Lines starting with # are
+// ignored.
+func InitPasswordPolicy() error {
+	if config.Current.Password.BreachedListFile == "" {
+		breachedPasswords = nil
+		return nil
+	}
+	list, err := loadBreachedPasswords(config.Current.Password.BreachedListFile)
+	if err != nil {
+		return fmt.Errorf("PASSWORD_BREACHED_LIST_FILE: %w", err)
+	}
+	breachedPasswords = list
+	return nil
+}
+
+func loadBreachedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			list[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		list[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// ValidatePassword applies the length and breached-list rules. Reuse of
+// earlier passwords is checked by the auth package, which knows the
+// account.
+func ValidatePassword(password string) error {
+	if utf8.RuneCountInString(password) < config.Current.Password.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, config.Current.Password.MinLength)
+	}
+	max := maxPasswordBytes
+	if config.Current.Password.Hasher == "bcrypt" {
+		max = bcryptMaxPasswordBytes
+	}
+	if len(password) > max {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, max)
+	}
+	if _, found := breachedPasswords[sha1Hex(password)]; found {
+		return fmt.Errorf("%w: this password appears in a list of breached passwords", ErrWeakPassword)
+	}
+	return nil
+}
+
+// Hash password ດ້ວຍ hasher ທີ່ຕັ້ງຄ່າໄວ້ (bcrypt ຫຼື argon2id)
+func HashPassword(password string) (string, error) {
+	if config.Current.Password.Hasher == "argon2id" {
+		return hashArgon2id(password)
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), config.Current.Password.BcryptCost)
+	return string(bytes), err
+}
+
+// ກວດສອບວ່າ password ຖືກຕ້ອງບໍ່. Hash ເກົ່າທີ່ໃຊ້ hasher ອື່ນຍັງໃຊ້ໄດ້.
+func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}
+
+// NeedsRehash reports whether hash was made with another hasher or with
+// parameters different from the current settings. Call it after a
+// successful CheckPasswordHash and store a new hash when it returns true.
+func NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		if config.Current.Password.Hasher != "argon2id" {
+			return true
+		}
+		params, _, key, err := decodeArgon2id(hash)
+		return err != nil || params != currentArgon2Params() || len(key) != argon2KeyLength
+	}
+	if config.Current.Password.Hasher != "bcrypt" {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != config.Current.Password.BcryptCost
+}
+
+// dummyHash is compared against when an account does not exist, so a
+// failed login takes the same time whether or not the account exists.
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("dummy-password")
+	if err != nil {
+		log.Printf("hash dummy password: %v", err)
+	}
+	return hash
+})
+
+// SimulatePasswordCheck spends the same time as CheckPasswordHash for a
+// login whose account does not exist.
+func SimulatePasswordCheck(password string) {
+	_ = CheckPasswordHash(password, dummyHash())
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func currentArgon2Params() argon2Params {
+	return argon2Params{
+		memory:      uint32(config.Current.Password.Argon2Memory),
+		iterations:  uint32(config.Current.Password.Argon2Iterations),
+		parallelism: uint8(config.Current.Password.Argon2Parallelism),
+	}
+}
+
+// hashArgon2id encodes the hash in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func hashArgon2id(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := currentArgon2Params()
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeyLength)
+	b64 := base64.RawStdEncoding.EncodeToString
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.iterations, p.parallelism, b64(salt), b64(key)), nil
+}
+
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, err
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	if p.iterations == 0 || p.parallelism == 0 || len(key) == 0 {
+		return p, nil, nil, errors.New("malformed argon2id hash")
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"example.com/go-xampp-api/config"
+)
+
+// ErrInvalidPhone is returned for numbers that cannot be turned into E.164.
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalizePhone converts a phone number to E.164. Spaces, dashes, dots
+// and parentheses are ignored. Numbers without a country code are taken
+// as national numbers of PHONE_DEFAULT_COUNTRY_CODE, so with the default
+// (Laos, +856) "020 5555 1234" becomes "+8562055551234".
+func NormalizePhone(raw string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case strings.ContainsRune(" -.()", r):
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	cc := config.Current.Phone.DefaultCountryCode
+	n := b.String()
+	switch {
+	case strings.HasPrefix(n, "+"):
+	case strings.HasPrefix(n, "00"):
+		n = "+" + n[2:]
+	case strings.HasPrefix(n, "0"):
+		n = "+" + cc + n[1:] // national number with trunk prefix
+	case strings.HasPrefix(n, cc) && len(n) >= len(cc)+8:
+		n = "+" + n // international number without "+"
+	default:
+		n = "+" + cc + n
+	}
+
+	if !e164.MatchString(n) {
+		return "", ErrInvalidPhone
+	}
+	// Lao numbers have 8 (landline) to 10 (mobile, 20 XXXX XXXX) digits
+	// after the country code.
+	if national, ok := strings.CutPrefix(n, "+856"); ok && (len(national) < 8 || len(national) > 10) {
+		return "", ErrInvalidPhone
+	}
+	return n, nil
+}